@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/andresneva/mongo_driver_test/config"
+	"github.com/andresneva/mongo_driver_test/history"
+	"github.com/andresneva/mongo_driver_test/report"
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//Report executes the report command: it writes the HTML report of a stage of the history or of a result file
+func Report(args []string) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	id := flags.String("id", "", "id of a stage of the history")
+	file := flags.String("f", "", "result file written by the run command")
+	output := flags.String("o", "report.html", "file to write the report to")
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if (*id == "") == (*file == "") {
+		logrus.Error("Either the stage id or the result file is required: report -id <id> | -f result.json")
+		return ExitError
+	}
+
+	result, err := readResult(*id, *file)
+	if err != nil {
+		logrus.Error(err)
+		return ExitError
+	}
+	if err := writeReport(*output, result); err != nil {
+		logrus.Error(err)
+		return ExitError
+	}
+	return ExitPassed
+}
+
+func readResult(id string, file string) (*stage.StageResult, error) {
+	if id != "" {
+		store, err := history.NewStore(config.LoadConfig().DataDir)
+		if err != nil {
+			return nil, err
+		}
+		return store.Get(id)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading the result: %v", err)
+	}
+	var result stage.StageResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("parsing the result %s: %v", file, err)
+	}
+	return &result, nil
+}
+
+//writeReport writes the HTML report of the result to the file
+func writeReport(file string, result *stage.StageResult) error {
+	out, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("writing the report: %v", err)
+	}
+	defer out.Close()
+
+	if err := report.Write(out, result); err != nil {
+		return fmt.Errorf("writing the report: %v", err)
+	}
+	logrus.Printf("Report written to %s", file)
+	return nil
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/andresneva/mongo_driver_test/config"
+	"github.com/andresneva/mongo_driver_test/history"
+	"github.com/andresneva/mongo_driver_test/scenario"
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//Exit codes of the commands
+const (
+	ExitPassed    = 0
+	ExitSLOFailed = 1
+	ExitError     = 2
+)
+
+//Run executes the run command: it runs the stage of a scenario file in the foreground and writes its result,
+//the logs go to stderr
+func Run(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	file := flags.String("f", "", "scenario file in YAML or JSON with the db_config and the stage_config, as in the POST to /stages/")
+	output := flags.String("o", "", "file to write the result to, stdout by default")
+	reportFile := flags.String("report", "", "file to write the HTML report to")
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if *file == "" {
+		logrus.Error("The scenario file is required: run -f scenario.json")
+		return ExitError
+	}
+
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		logrus.Errorf("Reading the scenario: %v", err)
+		return ExitError
+	}
+	testConfig, err := scenario.Parse(content)
+	if err != nil {
+		logrus.Errorf("Invalid scenario %s: %v", *file, err)
+		return ExitError
+	}
+	stageImpl, validations := scenario.NewStage(testConfig)
+	if len(validations) > 0 {
+		logrus.Errorf("Invalid scenario %s: %+v", *file, validations)
+		return ExitError
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	result := stageImpl.Run(ctx, stage.GenerateID())
+	saveHistory(result)
+
+	if err := writeResult(*output, result); err != nil {
+		logrus.Error(err)
+		return ExitError
+	}
+	if *reportFile != "" {
+		if err := writeReport(*reportFile, result); err != nil {
+			logrus.Error(err)
+			return ExitError
+		}
+	}
+	return exitCode(result)
+}
+
+//saveHistory saves the results into the history store under the DATA_DIR, a failure is only logged
+func saveHistory(results ...*stage.StageResult) {
+	store, err := history.NewStore(config.LoadConfig().DataDir)
+	if err != nil {
+		logrus.Error(err)
+		return
+	}
+	for _, result := range results {
+		if err := store.Save(result); err != nil {
+			logrus.WithField("stage", result.ID).Errorf("Saving the result: %v", err)
+		}
+	}
+}
+
+//interruptContext is cancelled by an interrupt, the partial result of the cancelled stages is still written
+func interruptContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+//writeResult writes the document as indented JSON to the file, or to stdout when it is empty
+func writeResult(file string, document interface{}) error {
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	content = append(content, '\n')
+	if file == "" {
+		_, err = os.Stdout.Write(content)
+		return err
+	}
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		return fmt.Errorf("writing the result: %v", err)
+	}
+	logrus.Printf("Result written to %s", file)
+	return nil
+}
+
+//exitCode is ExitError when the stage did not finish and ExitSLOFailed when an assertion was violated
+func exitCode(result *stage.StageResult) int {
+	if result.Phase != stage.PhaseFinished {
+		return ExitError
+	}
+	if result.Verdict != nil && !result.Verdict.Passed {
+		return ExitSLOFailed
+	}
+	return ExitPassed
+}
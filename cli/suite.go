@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"flag"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/andresneva/mongo_driver_test/scenario"
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//Suite executes the suite command: it runs the stages of a suite file one after the other and writes
+//the combined report
+func Suite(args []string) int {
+	flags := flag.NewFlagSet("suite", flag.ContinueOnError)
+	file := flags.String("f", "", "suite file in YAML or JSON, as in the POST to /suites/")
+	output := flags.String("o", "", "file to write the report to, stdout by default")
+	if err := flags.Parse(args); err != nil {
+		return ExitError
+	}
+	if *file == "" {
+		logrus.Error("The suite file is required: suite -f suite.yaml")
+		return ExitError
+	}
+
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		logrus.Errorf("Reading the suite: %v", err)
+		return ExitError
+	}
+	suite, validations, err := scenario.NewSuite(content)
+	if err != nil {
+		logrus.Errorf("Invalid suite %s: %v", *file, err)
+		return ExitError
+	}
+	if len(validations) > 0 {
+		logrus.Errorf("Invalid suite %s: %+v", *file, validations)
+		return ExitError
+	}
+
+	ctx, stop := interruptContext()
+	defer stop()
+	report := suite.Run(ctx, stage.GenerateID(), nil)
+	for _, stageReport := range report.Stages {
+		if stageReport.Result != nil {
+			saveHistory(stageReport.Result)
+		}
+	}
+
+	if err := writeResult(*output, report); err != nil {
+		logrus.Error(err)
+		return ExitError
+	}
+	return suiteExitCode(report)
+}
+
+//suiteExitCode is ExitError when a stage did not finish and ExitSLOFailed when an assertion was violated
+func suiteExitCode(report stage.SuiteReport) int {
+	code := ExitPassed
+	for _, stageReport := range report.Stages {
+		if stageReport.Result == nil {
+			return ExitError
+		}
+		if stageCode := exitCode(stageReport.Result); stageCode > code {
+			code = stageCode
+		}
+	}
+	return code
+}
@@ -5,17 +5,24 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type AppConfig struct {
 	Port     int
 	BasePath string
+	DataDir  string
+	//StageRetention is how long the finished stages are kept in memory, their results stay in the history
+	StageRetention time.Duration
 }
 
 func LoadConfig() AppConfig {
 	return AppConfig{
 		Port:     getIntEnvOrDefault("SERVER_PORT", 8090),
 		BasePath: getEnvOrDefault("SERVER_BASE_PATH", "/api/v1"),
+		DataDir:  getEnvOrDefault("DATA_DIR", "data"),
+
+		StageRetention: getDurationEnvOrDefault("STAGE_RETENTION", time.Hour),
 	}
 }
 
@@ -28,6 +35,18 @@ func getEnvOrDefault(envName string, defaultValue string) string {
 	return value
 }
 
+func getDurationEnvOrDefault(envName string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(envName)
+	if strings.TrimSpace(value) == "" {
+		return defaultValue
+	}
+	result, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Wrong environment variable type. Expected '%s' of type duration", envName)
+	}
+	return result
+}
+
 func getIntEnvOrDefault(envName string, defaultValue int) int {
 	value := os.Getenv(envName)
 	if strings.TrimSpace(value) == "" {
@@ -0,0 +1,222 @@
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+	"github.com/sirupsen/logrus"
+)
+
+//ErrNotFound is returned for a stage that is not in the store
+var ErrNotFound = errors.New("stage not found in the history")
+
+//Store keeps the result of every stage as a JSON file under its directory
+type Store struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+//Entry sums up a stored stage
+type Entry struct {
+	ID              string      `json:"id"`
+	Tags            []string    `json:"tags,omitempty"`
+	Phase           stage.Phase `json:"phase"`
+	DriverVersion   string      `json:"driver_version"`
+	StartedAt       time.Time   `json:"started_at"`
+	FinishedAt      time.Time   `json:"finished_at"`
+	QueryCount      int64       `json:"query_count"`
+	Throughput      float64     `json:"throughput"`
+	ErrorPercentage string      `json:"error_percentage"`
+	P99Ms           float64     `json:"p99_ms"`
+	Passed          *bool       `json:"passed,omitempty"`
+}
+
+//stored holds the fields of a result file the listing needs, the rest of the file is skipped
+type stored struct {
+	ID              string      `json:"id"`
+	Phase           stage.Phase `json:"phase"`
+	DriverVersion   string      `json:"driver_version"`
+	StartedAt       time.Time   `json:"started_at"`
+	FinishedAt      time.Time   `json:"finished_at"`
+	QueryCount      int64       `json:"query_count"`
+	Throughput      float64     `json:"throughput"`
+	ErrorPercentage string      `json:"error_percentage"`
+	StageConfig     struct {
+		Tags []string `json:"tags"`
+	} `json:"stage_config"`
+	Latency struct {
+		P99Ms float64 `json:"p99_ms"`
+	} `json:"latency"`
+	Verdict *struct {
+		Passed bool `json:"passed"`
+	} `json:"verdict"`
+}
+
+//Filter selects the stored stages, the zero value selects every one
+type Filter struct {
+	//Since leaves out the stages started before it
+	Since time.Time
+	//Tags the stages must have, all of them
+	Tags []string
+}
+
+//NewStore opens the store under the directory, creating it if needed
+func NewStore(dir string) (*Store, error) {
+	dir = filepath.Join(dir, "stages")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating the history directory: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+//Save writes the result of a stage, replacing the previous one with the same id
+func (s *Store) Save(result *stage.StageResult) error {
+	content, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	//the file is renamed once written so a crash never leaves half a result
+	temp := s.path(result.ID) + ".tmp"
+	if err := os.WriteFile(temp, content, 0644); err != nil {
+		return fmt.Errorf("saving stage %s: %v", result.ID, err)
+	}
+	return os.Rename(temp, s.path(result.ID))
+}
+
+//Get reads the result of a stage, ErrNotFound if it is not stored
+func (s *Store) Get(id string) (*stage.StageResult, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return nil, ErrNotFound
+	}
+
+	s.mutex.RLock()
+	content, err := os.ReadFile(s.path(id))
+	s.mutex.RUnlock()
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result stage.StageResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("reading stage %s: %v", id, err)
+	}
+	return &result, nil
+}
+
+//List returns the stored stages selected by the filter, the oldest first.
+//The files that can not be read are logged and left out
+func (s *Store) List(filter Filter) ([]Entry, error) {
+	s.mutex.RLock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	s.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(files))
+	for _, file := range files {
+		result, err := s.read(file)
+		if err != nil {
+			logrus.WithField("file", file).Warnf("Skipping stored stage: %v", err)
+			continue
+		}
+		if result.StartedAt.Before(filter.Since) || !hasTags(result.StageConfig.Tags, filter.Tags) {
+			continue
+		}
+		entries = append(entries, result.entry())
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StartedAt.Before(entries[j].StartedAt)
+	})
+	return entries, nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *Store) read(file string) (*stored, error) {
+	s.mutex.RLock()
+	content, err := os.ReadFile(file)
+	s.mutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var result stored
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, err
+	}
+	if result.ID == "" {
+		return nil, errors.New("no stage id")
+	}
+	return &result, nil
+}
+
+func (result *stored) entry() Entry {
+	entry := Entry{
+		ID:              result.ID,
+		Tags:            result.StageConfig.Tags,
+		Phase:           result.Phase,
+		DriverVersion:   result.DriverVersion,
+		StartedAt:       result.StartedAt,
+		FinishedAt:      result.FinishedAt,
+		QueryCount:      result.QueryCount,
+		Throughput:      result.Throughput,
+		ErrorPercentage: result.ErrorPercentage,
+		P99Ms:           result.Latency.P99Ms,
+	}
+	if result.Verdict != nil {
+		passed := result.Verdict.Passed
+		entry.Passed = &passed
+	}
+	return entry
+}
+
+func hasTags(tags []string, wanted []string) bool {
+	for _, tag := range wanted {
+		found := false
+		for _, candidate := range tags {
+			if candidate == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//ParseSince reads a point in time as RFC3339, a date (2006-01-02) or a duration back from now (72h)
+func ParseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if since, err := time.Parse(time.RFC3339, value); err == nil {
+		return since, nil
+	}
+	if since, err := time.Parse("2006-01-02", value); err == nil {
+		return since, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("since must be RFC3339, a date (2006-01-02) or a duration (72h)")
+}
@@ -0,0 +1,87 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func save(t *testing.T, store *Store, id string, startedAt time.Time, tags ...string) {
+	t.Helper()
+	result := &stage.StageResult{ID: id, Phase: stage.PhaseFinished, StartedAt: startedAt}
+	result.StageConfig.Tags = tags
+	if err := store.Save(result); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListSkipsUnreadableFiles(t *testing.T) {
+	store := newTestStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	save(t, store, "second", start.Add(time.Hour))
+	save(t, store, "first", start)
+
+	//a corrupt file, one partially written and a write that never got renamed
+	for name, content := range map[string]string{
+		"corrupt.json":     "not json",
+		"partial.json":     `{"id":"partial","phase":"fin`,
+		"pending.json.tmp": `{"id":"pending"}`,
+	} {
+		if err := os.WriteFile(filepath.Join(store.dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := store.List(Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != "first" || entries[1].ID != "second" {
+		t.Errorf("got %+v, want first and second", entries)
+	}
+}
+
+func TestListFilter(t *testing.T) {
+	store := newTestStore(t)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	save(t, store, "old", start, "nightly")
+	save(t, store, "tagged", start.Add(time.Hour), "nightly", "v1.15")
+	save(t, store, "untagged", start.Add(time.Hour))
+
+	entries, err := store.List(Filter{Since: start.Add(time.Minute), Tags: []string{"nightly"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "tagged" {
+		t.Errorf("got %+v, want only tagged", entries)
+	}
+	if tags := entries[0].Tags; len(tags) != 2 {
+		t.Errorf("tags: got %v, want nightly and v1.15", tags)
+	}
+}
+
+func TestGet(t *testing.T) {
+	store := newTestStore(t)
+	save(t, store, "stored", time.Now())
+
+	if result, err := store.Get("stored"); err != nil || result.ID != "stored" {
+		t.Errorf("got %v %v, want the stored stage", result, err)
+	}
+	for _, id := range []string{"missing", "", "../stored"} {
+		if _, err := store.Get(id); err != ErrNotFound {
+			t.Errorf("%q: got %v, want %v", id, err, ErrNotFound)
+		}
+	}
+}
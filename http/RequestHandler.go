@@ -1,149 +1,320 @@
 package http
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"strings"
 	"time"
 
-	"github.com/andresneva/mongo_driver_test/repositories"
+	"github.com/andresneva/mongo_driver_test/history"
+	"github.com/andresneva/mongo_driver_test/report"
+	"github.com/andresneva/mongo_driver_test/scenario"
 	"github.com/andresneva/mongo_driver_test/stage"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 //RequestHandler struct
 type RequestHandler struct {
+	registry  *stage.Registry
+	suites    *stage.SuiteRegistry
+	scheduler *stage.Scheduler
+	history   *history.Store
 }
 
-//NewRequestHandler gets a new handler
-func NewRequestHandler() *RequestHandler {
-	return &RequestHandler{}
+//NewRequestHandler gets a new handler, the result of every stage is saved into the history store and
+//the stages and suites are dropped from memory once they are done for longer than retention
+func NewRequestHandler(store *history.Store, retention time.Duration) *RequestHandler {
+	handler := &RequestHandler{
+		registry:  stage.NewRegistry(),
+		suites:    stage.NewSuiteRegistry(),
+		scheduler: stage.NewScheduler(context.Background(), saveResult(store)),
+		history:   store,
+	}
+	go handler.pruneStages(retention)
+	return handler
+}
+
+//pruneStages drops the stages and suites done for longer than retention from the registries, so the
+//status lists and the metrics do not grow with every stage run by the server
+func (r *RequestHandler) pruneStages(retention time.Duration) {
+	ticker := time.NewTicker(pruneInterval(retention))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		doneBefore := time.Now().Add(-retention)
+		for _, id := range r.registry.Prune(doneBefore) {
+			logrus.WithField("stage", id).Info("Stage dropped from memory")
+		}
+		for _, id := range r.suites.Prune(doneBefore) {
+			logrus.WithField("suite", id).Info("Suite dropped from memory")
+		}
+	}
+}
+
+//pruneInterval checks ten times by retention, and at least every minute
+func pruneInterval(retention time.Duration) time.Duration {
+	if interval := retention / 10; interval > 0 && interval < time.Minute {
+		return interval
+	}
+	return time.Minute
+}
+
+//saveResult returns a callback that saves the stage results into the store
+func saveResult(store *history.Store) func(*stage.StageResult) {
+	return func(result *stage.StageResult) {
+		if err := store.Save(result); err != nil {
+			logrus.WithField("stage", result.ID).Errorf("Saving the result: %v", err)
+		}
+	}
 }
 
-//RunTest executes the test
+//RunTest queues the test, the stages run one at a time
 func (r *RequestHandler) RunTest(c *gin.Context) {
-	var requestBody TestConfig
+	var requestBody scenario.TestConfig
 	if err := c.ShouldBindJSON(&requestBody); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if result := validateConfig(&requestBody); len(result) > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"validations": fmt.Sprintf("%+v", result)})
-		return
-	}
-
-	stageImpl := stage.New(
-		repositories.MongoDBConfiguration{
-			DbName:         requestBody.DBConfig.DbName,
-			CollectionName: requestBody.DBConfig.CollectionName,
-			ConnString:     requestBody.DBConfig.ConnString,
-			MinPool:        uint64(requestBody.DBConfig.MinPoolSize),
-			MaxPool:        uint64(requestBody.DBConfig.MaxPoolSize),
-			IdleTimeout:    time.Duration(requestBody.DBConfig.IdleTimeout) * time.Second,
-			SocketTimeout:  time.Duration(requestBody.DBConfig.SocketTimeout) * time.Second,
-		}, stage.Config{
-			WorkersCount:     requestBody.StageConfig.WorkersCount,
-			WorkersToAdd:     requestBody.StageConfig.WorkersToAdd,
-			IncrementLoad:    requestBody.StageConfig.IncrementLoad,
-			ProducersCount:   requestBody.StageConfig.ProducersCount,
-			MsgBySec:         requestBody.StageConfig.MsgBySec,
-			TimeToSleepSecs:  requestBody.StageConfig.TimeToSleepSecs,
-			TimeToFinishSecs: requestBody.StageConfig.TimeToFinishSecs,
-			QueryTimeoutMs:   requestBody.StageConfig.QueryTimeoutMs,
-			BatchSize:        int32(requestBody.StageConfig.BatchSize),
-			CollectionSize:   int(requestBody.StageConfig.CollectionSize),
-			DocumentSize:     int(requestBody.StageConfig.DocumentSize),
-		})
+	stageImpl, validations := scenario.NewStage(requestBody)
+	if len(validations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"validations": fmt.Sprintf("%+v", validations)})
+		return
+	}
+
 	stageID := stage.GenerateID()
-	go stageImpl.Run(stageID)
+	r.registry.Add(stageID, stageImpl)
+	position := r.scheduler.Submit(stageID, stageImpl)
 
-	c.JSON(http.StatusCreated, gin.H{"stageId": stageID})
+	c.JSON(http.StatusCreated, gin.H{"stageId": stageID, "queuePosition": position})
 }
 
-func validateConfig(requestBody *TestConfig) []string {
-	var result []string
-
-	if isEmpty(requestBody.DBConfig.DbName) {
-		result = append(result, "Database' name is required")
+//GetStage returns the status of a single stage
+func (r *RequestHandler) GetStage(c *gin.Context) {
+	stageImpl, ok := r.registry.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stage not found"})
+		return
 	}
-	if isEmpty(requestBody.DBConfig.ConnString) {
-		result = append(result, "Connection string is required")
+
+	c.JSON(http.StatusOK, stageImpl.Status())
+}
+
+//CancelStage removes a queued stage or stops a running one, the final stats are still produced
+func (r *RequestHandler) CancelStage(c *gin.Context) {
+	stageImpl, ok := r.registry.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stage not found"})
+		return
 	}
-	if isEmpty(requestBody.DBConfig.CollectionName) {
-		result = append(result, "Collection name is required")
+
+	if !r.scheduler.Remove(c.Param("id")) && !stageImpl.Cancel() {
+		c.JSON(http.StatusConflict, gin.H{"error": "stage already done"})
+		return
 	}
-	if isEmptyNumber(requestBody.DBConfig.MaxPoolSize) {
-		result = append(result, "MaxPoolSize is required")
+
+	c.JSON(http.StatusAccepted, stageImpl.Status())
+}
+
+//ScaleStage changes the workers, the producers or the target rate of a running stage
+func (r *RequestHandler) ScaleStage(c *gin.Context) {
+	var requestBody ScaleConfig
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
-	if isEmptyNumber(requestBody.DBConfig.SocketTimeout) {
-		result = append(result, "Socket' timeout is required")
+	if requestBody.Workers == 0 && requestBody.Producers == 0 && requestBody.TargetRate == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"validations": "[Workers, producers or target rate is required]"})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.WorkersCount) {
-		result = append(result, "Workers count is required")
+
+	stageImpl, ok := r.registry.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stage not found"})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.QueryTimeoutMs) {
-		result = append(result, "Query' timeout is required")
+
+	err := stageImpl.Scale(int(requestBody.Workers), int(requestBody.Producers), float64(requestBody.TargetRate))
+	if err == stage.ErrNotRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "phase": stageImpl.Status().Phase})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.WorkersToAdd) {
-		result = append(result, "Workers to add is required")
+
+	c.JSON(http.StatusOK, stageImpl.Status())
+}
+
+//GetStageResult returns the final document of a finished stage
+func (r *RequestHandler) GetStageResult(c *gin.Context) {
+	stageImpl, ok := r.registry.Get(c.Param("id"))
+	if !ok {
+		r.getStoredResult(c)
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.IncrementLoad) {
-		result = append(result, "Increment load is required")
+
+	result, ok := stageImpl.Result()
+	if !ok {
+		c.JSON(http.StatusConflict, gin.H{"error": "stage still running", "phase": stageImpl.Status().Phase})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.MsgBySec) {
-		result = append(result, "Messages per second is required")
+
+	c.JSON(http.StatusOK, result)
+}
+
+//GetStageReport returns the HTML report of a finished stage
+func (r *RequestHandler) GetStageReport(c *gin.Context) {
+	result, status, err := r.result(c.Param("id"))
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.ProducersCount) {
-		result = append(result, "Producers' count is required")
+
+	var page bytes.Buffer
+	if err := report.Write(&page, result); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.TimeToSleepSecs) {
-		result = append(result, "Time to sleep is required")
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+//GetStageTimeSeries exports the per second samples of a stage as JSON Lines, or CSV with format=csv,
+//a running stage returns the samples taken so far
+func (r *RequestHandler) GetStageTimeSeries(c *gin.Context) {
+	format := c.DefaultQuery("format", "jsonl")
+	if format != "jsonl" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"validations": "[Format must be jsonl or csv]"})
+		return
 	}
-	if isEmptyNumber(requestBody.StageConfig.TimeToFinishSecs) {
-		result = append(result, "Time to finish is required")
+
+	var samples []stage.Sample
+	if stageImpl, ok := r.registry.Get(c.Param("id")); ok {
+		samples = stageImpl.TimeSeries()
+	} else {
+		result, status, err := r.result(c.Param("id"))
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		samples = result.TimeSeries
 	}
 
-	return result
+	var content bytes.Buffer
+	if format == "csv" {
+		writer := csv.NewWriter(&content)
+		if err := writer.WriteAll(stage.TimeSeriesCSV(samples)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", content.Bytes())
+		return
+	}
+	encoder := json.NewEncoder(&content)
+	for _, sample := range samples {
+		if err := encoder.Encode(sample); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.Data(http.StatusOK, "application/x-ndjson", content.Bytes())
 }
 
-func isEmpty(value string) bool {
-	return strings.TrimSpace(value) == ""
+//StreamStage pushes the samples and the phase changes of a stage as Server-Sent Events until it is done,
+//a comment is sent every 15 seconds so idle connections, like the one of a queued stage, are kept open
+func (r *RequestHandler) StreamStage(c *gin.Context) {
+	stageImpl, ok := r.registry.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stage not found"})
+		return
+	}
+
+	events, unsubscribe := stageImpl.Subscribe()
+	defer unsubscribe()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Name, event.Data)
+			return true
+		case <-keepAlive.C:
+			_, err := io.WriteString(w, ": keep-alive\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
 }
 
-func isEmptyNumber(value uint) bool {
-	return value == 0
+//ListStages returns the status of every stage started by the server, with since or tag it browses the history instead
+func (r *RequestHandler) ListStages(c *gin.Context) {
+	since, tags := c.Query("since"), c.QueryArray("tag")
+	if since == "" && len(tags) == 0 {
+		c.JSON(http.StatusOK, r.registry.List())
+		return
+	}
+
+	sinceTime, err := history.ParseSince(since)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	entries, err := r.history.List(history.Filter{Since: sinceTime, Tags: tags})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
 }
 
-//TestConfig struct
-type TestConfig struct {
-	DBConfig    DBConfig    `json:"db_config"`
-	StageConfig StageConfig `json:"stage_config"`
+//getStoredResult returns the result of a stage of a previous run of the server
+func (r *RequestHandler) getStoredResult(c *gin.Context) {
+	result, err := r.history.Get(c.Param("id"))
+	if err == history.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "stage not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
 }
 
-//DBConfig struct
-type DBConfig struct {
-	DbName         string `json:"db_name"`
-	CollectionName string `json:"collection_name"`
-	ConnString     string `json:"conn_string"`
-	MinPoolSize    uint   `json:"min_pool_size"`
-	MaxPoolSize    uint   `json:"max_pool_size"`
-	IdleTimeout    uint   `json:"idle_timeout"`
-	SocketTimeout  uint   `json:"socket_timeout"`
+//result returns the result of a stage of the registry, or of the history when it is not there, with the
+//status code of the failure
+func (r *RequestHandler) result(id string) (*stage.StageResult, int, error) {
+	if stageImpl, ok := r.registry.Get(id); ok {
+		result, ok := stageImpl.Result()
+		if !ok {
+			return nil, http.StatusConflict, fmt.Errorf("stage %s still running", id)
+		}
+		return result, http.StatusOK, nil
+	}
+
+	result, err := r.history.Get(id)
+	if err == history.ErrNotFound {
+		return nil, http.StatusNotFound, fmt.Errorf("stage %s not found", id)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return result, http.StatusOK, nil
 }
 
-//StageConfig struct
-type StageConfig struct {
-	WorkersCount     uint `json:"workers_count"`
-	WorkersToAdd     uint `json:"workers_to_add"`
-	IncrementLoad    uint `json:"increment_load"`
-	ProducersCount   uint `json:"producers_count"`
-	MsgBySec         uint `json:"msg_by_sec"`
-	TimeToSleepSecs  uint `json:"time_to_sleep_secs"`
-	TimeToFinishSecs uint `json:"time_to_finish_secs"`
-	QueryTimeoutMs   uint `json:"query_timeout_ms"`
-	BatchSize        uint `json:"batch_size"`
-	CollectionSize   uint `json:"collection_size"`
-	DocumentSize     uint `json:"document_size_kb"`
+//ScaleConfig struct, zero keeps the current value
+type ScaleConfig struct {
+	Workers    uint `json:"workers"`
+	Producers  uint `json:"producers"`
+	TargetRate uint `json:"target_rate"`
 }
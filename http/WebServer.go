@@ -36,7 +36,25 @@ func ConfigureRoutes(handler *RequestHandler, appConfig config.AppConfig) (*gin.
 		ctx.JSON(http.StatusOK, nil)
 	})
 
+	server.GET("/metrics", handler.Metrics)
+
 	server.POST(appConfig.BasePath+"/stages/", handler.RunTest)
+	server.GET(appConfig.BasePath+"/stages", handler.ListStages)
+	server.GET(appConfig.BasePath+"/stages/", handler.ListStages)
+	server.GET(appConfig.BasePath+"/stages/:id", handler.GetStage)
+	server.PATCH(appConfig.BasePath+"/stages/:id", handler.ScaleStage)
+	server.DELETE(appConfig.BasePath+"/stages/:id", handler.CancelStage)
+	server.GET(appConfig.BasePath+"/stages/:id/result", handler.GetStageResult)
+	server.GET(appConfig.BasePath+"/stages/:id/report", handler.GetStageReport)
+	server.GET(appConfig.BasePath+"/stages/:id/timeseries", handler.GetStageTimeSeries)
+	server.GET(appConfig.BasePath+"/stages/:id/stream", handler.StreamStage)
+
+	server.GET(appConfig.BasePath+"/compare", handler.Compare)
+
+	server.POST(appConfig.BasePath+"/suites/", handler.RunSuite)
+	server.GET(appConfig.BasePath+"/suites/", handler.ListSuites)
+	server.GET(appConfig.BasePath+"/suites/:id", handler.GetSuite)
+	server.DELETE(appConfig.BasePath+"/suites/:id", handler.CancelSuite)
 	return server, nil
 }
 
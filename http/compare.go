@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//Compare diffs the result of a candidate stage against a base one and flags the regressions
+func (r *RequestHandler) Compare(c *gin.Context) {
+	baseID, candidateID := c.Query("base"), c.Query("candidate")
+	if baseID == "" || candidateID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"validations": "[Base and candidate are required]"})
+		return
+	}
+	tolerance := float64(stage.DefaultTolerance)
+	if value := c.Query("tolerance"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"validations": "[Tolerance must be a positive percentage]"})
+			return
+		}
+		tolerance = parsed
+	}
+
+	base, status, err := r.result(baseID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	candidate, status, err := r.result(candidateID)
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stage.Compare(base, candidate, tolerance))
+}
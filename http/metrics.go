@@ -0,0 +1,242 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+	"github.com/andresneva/mongo_driver_test/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+//latencyBuckets are the upper bounds, in seconds, of the exported latency histogram
+var latencyBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//Metrics exposes the counters of every stage in the Prometheus text format
+func (r *RequestHandler) Metrics(c *gin.Context) {
+	stages := r.registry.All()
+	statuses := make([]stage.Status, len(stages))
+	latencies := make([]*stats.Histogram, len(stages))
+	commands := make([]stats.CommandSnapshot, len(stages))
+	topologies := make([]stats.ServerSnapshot, len(stages))
+	for i, stageImpl := range stages {
+		statuses[i] = stageImpl.Status()
+		latencies[i] = stageImpl.Latency()
+		commands[i] = stageImpl.Commands()
+		topologies[i] = stageImpl.Topology()
+	}
+
+	w := &metricsWriter{}
+
+	w.header("mongo_pool_connections_created_total", "Connections created by the pool", "counter")
+	for _, status := range statuses {
+		w.sample("mongo_pool_connections_created_total", float64(status.PoolStats.Created), "stage", status.ID)
+	}
+	w.header("mongo_pool_connections_closed_total", "Connections closed by the pool", "counter")
+	for _, status := range statuses {
+		w.sample("mongo_pool_connections_closed_total", float64(status.PoolStats.Closed), "stage", status.ID)
+	}
+	w.header("mongo_pool_connections_in_use", "Connections checked out of the pool", "gauge")
+	for _, status := range statuses {
+		w.sample("mongo_pool_connections_in_use", float64(status.PoolStats.InUse), "stage", status.ID)
+	}
+	w.header("mongo_pool_connections_returned_total", "Connections returned to the pool", "counter")
+	for _, status := range statuses {
+		w.sample("mongo_pool_connections_returned_total", float64(status.PoolStats.Returned), "stage", status.ID)
+	}
+	w.header("mongo_pool_gets_ok_total", "Successful connection checkouts", "counter")
+	for _, status := range statuses {
+		w.sample("mongo_pool_gets_ok_total", float64(status.PoolStats.GetsOK), "stage", status.ID)
+	}
+	w.header("mongo_pool_gets_failed_total", "Failed connection checkouts by reason", "counter")
+	for _, status := range statuses {
+		for _, reason := range sortedKeys(status.PoolStats.Reasons) {
+			w.sample("mongo_pool_gets_failed_total", float64(status.PoolStats.Reasons[reason]), "stage", status.ID, "reason", reason)
+		}
+	}
+	w.header("mongo_pool_connections_peak_in_use", "Highest number of connections checked out of the pool of an address", "gauge")
+	for _, status := range statuses {
+		for _, address := range status.PoolStats.Addresses() {
+			w.sample("mongo_pool_connections_peak_in_use", float64(status.PoolStats.Servers[address].PeakInUse), "stage", status.ID, "address", address)
+		}
+	}
+	w.header("mongo_pool_checkout_wait_p99_seconds", "99th percentile of the time waiting for a connection by address", "gauge")
+	for _, status := range statuses {
+		for _, address := range status.PoolStats.Addresses() {
+			w.sample("mongo_pool_checkout_wait_p99_seconds", status.PoolStats.Servers[address].CheckoutWait.P99Ms/1000, "stage", status.ID, "address", address)
+		}
+	}
+	w.header("mongo_pool_clears_total", "Pools cleared by address", "counter")
+	for _, status := range statuses {
+		for _, address := range status.PoolStats.Addresses() {
+			w.sample("mongo_pool_clears_total", float64(status.PoolStats.Servers[address].Clears), "stage", status.ID, "address", address)
+		}
+	}
+
+	w.header("stage_queries_started_total", "Queries sent to the database", "counter")
+	for _, status := range statuses {
+		w.sample("stage_queries_started_total", float64(status.QueryCount), "stage", status.ID)
+	}
+	w.header("stage_queries_completed_total", "Queries that returned, successfully or not", "counter")
+	for _, status := range statuses {
+		w.sample("stage_queries_completed_total", float64(status.Completed), "stage", status.ID)
+	}
+	w.header("stage_query_timeouts_total", "Queries that timed out", "counter")
+	for _, status := range statuses {
+		w.sample("stage_query_timeouts_total", float64(status.Timeouts), "stage", status.ID)
+	}
+	w.header("stage_requests_dropped_total", "Requests the open loop producers could not queue", "counter")
+	for _, status := range statuses {
+		w.sample("stage_requests_dropped_total", float64(status.Dropped), "stage", status.ID)
+	}
+	w.header("stage_requests_late_total", "Requests that started later than intended by more than the late threshold", "counter")
+	for _, status := range statuses {
+		w.sample("stage_requests_late_total", float64(status.Late), "stage", status.ID)
+	}
+	w.header("stage_query_errors_total", "Queries that returned an error by category", "counter")
+	for _, status := range statuses {
+		for _, category := range sortedKeys(status.ErrorBreakdown) {
+			w.sample("stage_query_errors_total", float64(status.ErrorBreakdown[category]), "stage", status.ID, "category", category)
+		}
+	}
+
+	w.header("stage_query_latency_seconds", "Latency of the queries, the execution time plus the queue wait of the open load model", "histogram")
+	for i, status := range statuses {
+		w.histogram("stage_query_latency_seconds", latencies[i], "stage", status.ID)
+	}
+
+	w.header("mongo_commands_total", "Commands by name and outcome", "counter")
+	for i, status := range statuses {
+		for _, name := range commands[i].Names() {
+			summary := commands[i].Commands[name]
+			w.sample("mongo_commands_total", float64(summary.Started), "stage", status.ID, "command", name, "outcome", "started")
+			w.sample("mongo_commands_total", float64(summary.Succeeded), "stage", status.ID, "command", name, "outcome", "succeeded")
+			w.sample("mongo_commands_total", float64(summary.Failed), "stage", status.ID, "command", name, "outcome", "failed")
+		}
+	}
+	w.header("mongo_command_failures_total", "Failed commands by failure code", "counter")
+	for i, status := range statuses {
+		for _, code := range sortedKeys(commands[i].Failures) {
+			w.sample("mongo_command_failures_total", float64(commands[i].Failures[code]), "stage", status.ID, "code", code)
+		}
+	}
+	w.header("mongo_command_duration_seconds", "Round trip of the commands measured by the command monitor", "histogram")
+	for i, status := range statuses {
+		for _, name := range commands[i].Names() {
+			w.histogram("mongo_command_duration_seconds", commands[i].Commands[name].Durations(), "stage", status.ID, "command", name)
+		}
+	}
+
+	w.header("mongo_server_heartbeats_total", "Server heartbeats by address and outcome", "counter")
+	for i, status := range statuses {
+		for _, address := range topologies[i].Addresses() {
+			heartbeat := topologies[i].Heartbeats[address]
+			w.sample("mongo_server_heartbeats_total", float64(heartbeat.Succeeded), "stage", status.ID, "address", address, "outcome", "succeeded")
+			w.sample("mongo_server_heartbeats_total", float64(heartbeat.Failed), "stage", status.ID, "address", address, "outcome", "failed")
+		}
+	}
+	w.header("mongo_server_heartbeat_p99_seconds", "99th percentile of the heartbeat duration by address", "gauge")
+	for i, status := range statuses {
+		for _, address := range topologies[i].Addresses() {
+			w.sample("mongo_server_heartbeat_p99_seconds", topologies[i].Heartbeats[address].Latency.P99Ms/1000, "stage", status.ID, "address", address)
+		}
+	}
+	w.header("mongo_server_max_lag_seconds", "Highest replication lag seen on a secondary", "gauge")
+	for i, status := range statuses {
+		for _, address := range topologies[i].Addresses() {
+			w.sample("mongo_server_max_lag_seconds", topologies[i].Heartbeats[address].MaxLagSecs, "stage", status.ID, "address", address)
+		}
+	}
+	w.header("mongo_topology_events_total", "Topology and server description changes", "counter")
+	for i, status := range statuses {
+		w.sample("mongo_topology_events_total", float64(topologies[i].EventCount), "stage", status.ID)
+	}
+
+	w.header("stage_workers", "Running workers", "gauge")
+	for _, status := range statuses {
+		w.sample("stage_workers", float64(status.Workers), "stage", status.ID)
+	}
+	w.header("stage_producers", "Running producers", "gauge")
+	for _, status := range statuses {
+		w.sample("stage_producers", float64(status.Producers), "stage", status.ID)
+	}
+	w.header("stage_rate", "Requests by second sent by the producers", "gauge")
+	for _, status := range statuses {
+		w.sample("stage_rate", status.Rate, "stage", status.ID)
+	}
+	w.header("stage_step", "Current load step", "gauge")
+	for _, status := range statuses {
+		w.sample("stage_step", float64(status.Step), "stage", status.ID)
+	}
+	//every phase is always exported, so a phase change does not start a new series
+	w.header("stage_phase", "Current phase of the stage, 1 for the current one", "gauge")
+	for _, status := range statuses {
+		for _, phase := range stage.StagePhases {
+			value := 0.0
+			if status.Phase == phase {
+				value = 1
+			}
+			w.sample("stage_phase", value, "stage", status.ID, "phase", string(phase))
+		}
+	}
+
+	c.Data(http.StatusOK, metricsContentType, w.buf.Bytes())
+}
+
+type metricsWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *metricsWriter) header(name string, help string, kind string) {
+	_, _ = fmt.Fprintf(&w.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+//sample writes a single value, labels are given as name and value pairs
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteString("{")
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.buf.WriteString(",")
+			}
+			_, _ = fmt.Fprintf(&w.buf, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		w.buf.WriteString("}")
+	}
+	w.buf.WriteString(" ")
+	w.buf.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.buf.WriteString("\n")
+}
+
+func (w *metricsWriter) histogram(name string, histogram *stats.Histogram, labels ...string) {
+	for _, bucket := range latencyBuckets {
+		count := histogram.CountAtOrBelow(int64(bucket * 1e6))
+		w.sample(name+"_bucket", float64(count), append(labels, "le", strconv.FormatFloat(bucket, 'g', -1, 64))...)
+	}
+	w.sample(name+"_bucket", float64(histogram.Count()), append(labels, "le", "+Inf")...)
+	w.sample(name+"_sum", float64(histogram.Sum())/1e6, labels...)
+	w.sample(name+"_count", float64(histogram.Count()), labels...)
+}
+
+func escapeLabel(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return strings.Replace(value, "\n", `\n`, -1)
+}
+
+func sortedKeys(values map[string]int64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+	"github.com/andresneva/mongo_driver_test/stage"
+
+	"github.com/gin-gonic/gin"
+)
+
+//parseMetrics reads the Prometheus text format into the type of every metric and the value of every sample
+func parseMetrics(t *testing.T, body string) (map[string]string, map[string]float64) {
+	types := make(map[string]string)
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				t.Fatalf("invalid type line %q", line)
+			}
+			types[fields[2]] = fields[3]
+			continue
+		}
+		separator := strings.LastIndex(line, " ")
+		if separator < 0 {
+			t.Fatalf("invalid sample %q", line)
+		}
+		value, err := strconv.ParseFloat(line[separator+1:], 64)
+		if err != nil {
+			t.Fatalf("invalid value in %q: %v", line, err)
+		}
+		series := line[:separator]
+		name := series
+		if brace := strings.Index(series, "{"); brace >= 0 {
+			if !strings.HasSuffix(series, "}") {
+				t.Fatalf("invalid labels in %q", line)
+			}
+			name = series[:brace]
+		}
+		if !hasType(types, name) {
+			t.Errorf("sample %q before the type of its metric", line)
+		}
+		samples[series] = value
+	}
+	return types, samples
+}
+
+//hasType tells if the metric of the sample has a type, the histogram samples add a suffix to its name
+func hasType(types map[string]string, name string) bool {
+	if _, ok := types[name]; ok {
+		return true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if types[strings.TrimSuffix(name, suffix)] == "histogram" {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &RequestHandler{registry: stage.NewRegistry()}
+	handler.registry.Add("s1", stage.New(repositories.MongoDBConfiguration{}, stage.Config{}))
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	handler.Metrics(c)
+
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != metricsContentType {
+		t.Fatalf("got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	types, samples := parseMetrics(t, recorder.Body.String())
+
+	for name, kind := range map[string]string{
+		"mongo_pool_connections_created_total": "counter",
+		"stage_queries_started_total":          "counter",
+		"stage_query_latency_seconds":          "histogram",
+		"stage_workers":                        "gauge",
+		"stage_phase":                          "gauge",
+	} {
+		if types[name] != kind {
+			t.Errorf("%s: got type %q, want %q", name, types[name], kind)
+		}
+	}
+	for series, want := range map[string]float64{
+		`stage_queries_started_total{stage="s1"}`:                  0,
+		`stage_query_latency_seconds_bucket{stage="s1",le="+Inf"}`: 0,
+		`stage_query_latency_seconds_count{stage="s1"}`:            0,
+		`stage_phase{stage="s1",phase="pending"}`:                  1,
+		`stage_phase{stage="s1",phase="finished"}`:                 0,
+	} {
+		if value, ok := samples[series]; !ok || value != want {
+			t.Errorf("%s: got %v %v, want %v", series, value, ok, want)
+		}
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("got %s", got)
+	}
+}
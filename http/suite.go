@@ -0,0 +1,74 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/andresneva/mongo_driver_test/scenario"
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//RunSuite starts the stages of a suite one after the other
+func (r *RequestHandler) RunSuite(c *gin.Context) {
+	content, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	suite, validations, err := scenario.NewSuite(content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(validations) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"validations": fmt.Sprintf("%+v", validations)})
+		return
+	}
+
+	suiteID := stage.GenerateID()
+	stageIds := make([]string, 0, len(suite.Stages()))
+	for _, suiteStage := range suite.Stages() {
+		r.registry.Add(suiteStage.ID, suiteStage.Stage)
+		stageIds = append(stageIds, suiteStage.ID)
+	}
+	r.suites.Add(suiteID, suite)
+	go suite.Run(context.Background(), suiteID, r.scheduler)
+
+	c.JSON(http.StatusCreated, gin.H{"suiteId": suiteID, "stageIds": stageIds})
+}
+
+//GetSuite returns the combined report of a suite, with the results of the stages done so far
+func (r *RequestHandler) GetSuite(c *gin.Context) {
+	suite, ok := r.suites.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "suite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, suite.Report())
+}
+
+//ListSuites returns the report of every suite started by the server
+func (r *RequestHandler) ListSuites(c *gin.Context) {
+	c.JSON(http.StatusOK, r.suites.List())
+}
+
+//CancelSuite stops the running stage of a suite and skips the rest
+func (r *RequestHandler) CancelSuite(c *gin.Context) {
+	suite, ok := r.suites.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "suite not found"})
+		return
+	}
+
+	if !suite.Cancel() {
+		c.JSON(http.StatusConflict, gin.H{"error": "suite already done"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, suite.Report())
+}
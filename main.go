@@ -1,18 +1,36 @@
 package main
 
 import (
+	"os"
 	"strconv"
 
+	"github.com/andresneva/mongo_driver_test/cli"
 	"github.com/andresneva/mongo_driver_test/config"
+	"github.com/andresneva/mongo_driver_test/history"
 	"github.com/andresneva/mongo_driver_test/http"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(cli.Run(os.Args[2:]))
+		case "suite":
+			os.Exit(cli.Suite(os.Args[2:]))
+		case "report":
+			os.Exit(cli.Report(os.Args[2:]))
+		}
+	}
+
 	appConfig := config.LoadConfig()
 
-	handler := http.NewRequestHandler()
+	store, err := history.NewStore(appConfig.DataDir)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	handler := http.NewRequestHandler(store, appConfig.StageRetention)
 
 	server, err := http.ConfigureRoutes(handler, appConfig)
 	if err != nil {
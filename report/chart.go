@@ -0,0 +1,133 @@
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+)
+
+//Size of the charts, in pixels
+const (
+	chartWidth   = 860
+	chartHeight  = 240
+	marginLeft   = 60
+	marginRight  = 20
+	marginTop    = 30
+	marginBottom = 40
+)
+
+//colors of the series, in order
+var colors = []string{"#1f77b4", "#ff7f0e", "#d62728", "#2ca02c", "#9467bd"}
+
+//point of a series, x in seconds from the start of the stage
+type point struct {
+	x float64
+	y float64
+}
+
+type series struct {
+	name   string
+	points []point
+}
+
+//boundary marks the start of a step on the charts
+type boundary struct {
+	x     float64
+	label string
+}
+
+//chart is a line chart drawn as inline SVG, so the report needs nothing else to be shown
+type chart struct {
+	title      string
+	unit       string
+	duration   float64
+	series     []series
+	boundaries []boundary
+}
+
+//SVG draws the chart
+func (c chart) SVG() template.HTML {
+	plotWidth := float64(chartWidth - marginLeft - marginRight)
+	plotHeight := float64(chartHeight - marginTop - marginBottom)
+	maxY := niceMax(c.maxY())
+	duration := math.Max(c.duration, 1)
+	x := func(value float64) float64 { return marginLeft + plotWidth*value/duration }
+	y := func(value float64) float64 { return marginTop + plotHeight*(1-value/maxY) }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="sans-serif" font-size="11">`, chartWidth, chartHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="18" font-size="14" font-weight="bold">%s</text>`, marginLeft, template.HTMLEscapeString(c.title))
+
+	//grid and axes
+	for i := 0; i <= 4; i++ {
+		value := maxY * float64(i) / 4
+		fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e0e0e0"/>`, marginLeft, y(value), x(duration), y(value))
+		fmt.Fprintf(&b, `<text x="%d" y="%.1f" text-anchor="end">%s</text>`, marginLeft-6, y(value)+4, formatValue(value))
+	}
+	for i := 0; i <= 5; i++ {
+		value := duration * float64(i) / 5
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" text-anchor="middle">%.0fs</text>`, x(value), chartHeight-marginBottom+16, value)
+	}
+	fmt.Fprintf(&b, `<text x="12" y="%.1f" transform="rotate(-90 12 %.1f)" text-anchor="middle">%s</text>`,
+		marginTop+plotHeight/2, marginTop+plotHeight/2, template.HTMLEscapeString(c.unit))
+
+	//step boundaries
+	for _, boundary := range c.boundaries {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%.1f" stroke="#999" stroke-dasharray="4 3"/>`,
+			x(boundary.x), marginTop, x(boundary.x), y(0))
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" fill="#666">%s</text>`, x(boundary.x)+3, marginTop+10, template.HTMLEscapeString(boundary.label))
+	}
+
+	//series and legend
+	for i, series := range c.series {
+		color := colors[i%len(colors)]
+		var path []string
+		for _, point := range series.points {
+			path = append(path, fmt.Sprintf("%.1f,%.1f", x(point.x), y(point.y)))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(path, " "))
+		if len(series.points) < 60 {
+			for _, point := range series.points {
+				fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="3" fill="%s"><title>%s %.0fs: %s</title></circle>`,
+					x(point.x), y(point.y), color, template.HTMLEscapeString(series.name), point.x, formatValue(point.y))
+			}
+		}
+		legendX := marginLeft + 120*i
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="10" height="10" fill="%s"/>`, legendX, chartHeight-14, color)
+		fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, legendX+14, chartHeight-5, template.HTMLEscapeString(series.name))
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func (c chart) maxY() float64 {
+	var max float64
+	for _, series := range c.series {
+		for _, point := range series.points {
+			max = math.Max(max, point.y)
+		}
+	}
+	return max
+}
+
+//niceMax rounds the top of the y axis up to 1, 2, 2.5 or 5 times a power of ten
+func niceMax(value float64) float64 {
+	if value <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(value)))
+	for _, step := range []float64{1, 2, 2.5, 5, 10} {
+		if value <= step*magnitude {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func formatValue(value float64) string {
+	if value == math.Trunc(value) {
+		return fmt.Sprintf("%.0f", value)
+	}
+	return fmt.Sprintf("%.2f", value)
+}
@@ -0,0 +1,134 @@
+package report
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//go:embed report.html
+var reportTemplate string
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percentage": func(value float64) string { return fmt.Sprintf("%.2f", value) },
+}).Parse(reportTemplate))
+
+//view is what the template shows
+type view struct {
+	Result *stage.StageResult
+	Charts []chart
+	Config string
+	Errors []errorCount
+}
+
+type errorCount struct {
+	Category string
+	Count    int64
+}
+
+//Write renders the HTML report of a stage result, the charts are inline SVG so the page is self-contained
+func Write(w io.Writer, result *stage.StageResult) error {
+	config, err := json.MarshalIndent(struct {
+		DBConfig    stage.DBSettings `json:"db_config"`
+		StageConfig stage.Config     `json:"stage_config"`
+	}{result.DBConfig, result.StageConfig}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return page.Execute(w, view{
+		Result: result,
+		Charts: charts(result),
+		Config: string(config),
+		Errors: errorCounts(result.Errors),
+	})
+}
+
+//charts draws the time series of the stage, or a point at the end of every step for the results
+//without one, with a boundary at the start of every step
+func charts(result *stage.StageResult) []chart {
+	var boundaries []boundary
+	for _, step := range result.Steps {
+		label := fmt.Sprintf("%d %s", step.Step, step.Phase)
+		if step.Name != "" {
+			label = fmt.Sprintf("%d %s", step.Step, step.Name)
+		}
+		boundaries = append(boundaries, boundary{x: step.StartedAt.Sub(result.StartedAt).Seconds(), label: label})
+	}
+	newChart := func(title string, unit string, series ...series) chart {
+		return chart{title: title, unit: unit, duration: result.DurationSecs, series: series, boundaries: boundaries}
+	}
+
+	if len(result.TimeSeries) == 0 {
+		return stepCharts(result, newChart)
+	}
+
+	throughput := series{name: "queries/s"}
+	p50, p90, p99 := series{name: "p50"}, series{name: "p90"}, series{name: "p99"}
+	inUse, backlog := series{name: "in use"}, series{name: "backlog"}
+	created, closed := series{name: "created"}, series{name: "closed"}
+	errors, timeouts := series{name: "errors"}, series{name: "timeouts"}
+	for _, sample := range result.TimeSeries {
+		x := sample.ElapsedSecs
+		throughput.points = append(throughput.points, point{x, sample.Throughput})
+		p50.points = append(p50.points, point{x, sample.P50Ms})
+		p90.points = append(p90.points, point{x, sample.P90Ms})
+		p99.points = append(p99.points, point{x, sample.P99Ms})
+		inUse.points = append(inUse.points, point{x, float64(sample.InUse)})
+		backlog.points = append(backlog.points, point{x, float64(sample.Backlog)})
+		created.points = append(created.points, point{x, float64(sample.Created)})
+		closed.points = append(closed.points, point{x, float64(sample.Closed)})
+		errors.points = append(errors.points, point{x, float64(sample.Errors)})
+		timeouts.points = append(timeouts.points, point{x, float64(sample.Timeouts)})
+	}
+	return []chart{
+		newChart("Throughput", "queries by second", throughput),
+		newChart("Latency percentiles", "ms", p50, p90, p99),
+		newChart("Connections in use and request backlog", "connections/requests", inUse, backlog),
+		newChart("Connections created and closed", "connections", created, closed),
+		newChart("Errors", "queries", errors, timeouts),
+	}
+}
+
+//stepCharts draws a point at the end of every step
+func stepCharts(result *stage.StageResult, newChart func(string, string, ...series) chart) []chart {
+	throughput := series{name: "queries/s"}
+	p50, p90, p99 := series{name: "p50"}, series{name: "p90"}, series{name: "p99"}
+	inUse := series{name: "in use"}
+	created, closed := series{name: "created"}, series{name: "closed"}
+	errors, timeouts := series{name: "errors"}, series{name: "timeouts"}
+
+	for _, step := range result.Steps {
+		x := step.FinishedAt.Sub(result.StartedAt).Seconds()
+		throughput.points = append(throughput.points, point{x, step.Throughput})
+		p50.points = append(p50.points, point{x, step.Latency.P50Ms})
+		p90.points = append(p90.points, point{x, step.Latency.P90Ms})
+		p99.points = append(p99.points, point{x, step.Latency.P99Ms})
+		inUse.points = append(inUse.points, point{x, float64(step.PoolStats.InUse)})
+		created.points = append(created.points, point{x, float64(step.PoolStats.Created)})
+		closed.points = append(closed.points, point{x, float64(step.PoolStats.Closed)})
+		errors.points = append(errors.points, point{x, float64(step.ErrorCount)})
+		timeouts.points = append(timeouts.points, point{x, float64(step.Timeouts)})
+	}
+	return []chart{
+		newChart("Throughput", "queries by second", throughput),
+		newChart("Latency percentiles", "ms", p50, p90, p99),
+		newChart("Connections in use", "connections", inUse),
+		newChart("Connections created and closed", "connections", created, closed),
+		newChart("Errors by step", "queries", errors, timeouts),
+	}
+}
+
+func errorCounts(errors map[string]int64) []errorCount {
+	counts := make([]errorCount, 0, len(errors))
+	for category, count := range errors {
+		counts = append(counts, errorCount{category, count})
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].Count > counts[j].Count })
+	return counts
+}
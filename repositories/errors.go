@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+//Error categories returned by ClassifyError
+const (
+	ErrorMaxTimeMSExpired       = "max_time_ms_expired"
+	ErrorSocketTimeout          = "socket_timeout"
+	ErrorPoolCheckoutTimeout    = "pool_checkout_timeout"
+	ErrorServerSelectionTimeout = "server_selection_timeout"
+	ErrorClientDeadline         = "client_deadline"
+	ErrorWriteConcernTimeout    = "write_concern_timeout"
+	ErrorNetwork                = "network_error"
+	ErrorDecode                 = "decode_error"
+	ErrorWrite                  = "write_error"
+	ErrorServer                 = "server_error"
+	ErrorCancelled              = "cancelled"
+	ErrorOther                  = "other"
+)
+
+//Server error codes
+const (
+	//maxTimeMSExpiredCode is returned when an operation runs past its maxTimeMS
+	maxTimeMSExpiredCode = 50
+	//writeConcernFailedCode is returned when the write concern was not satisfied within wtimeout
+	writeConcernFailedCode = 64
+)
+
+//DecodeError is returned when a document can not be decoded into its struct
+type DecodeError struct {
+	Err error
+}
+
+func (e DecodeError) Error() string {
+	return "decoding document: " + e.Err.Error()
+}
+
+//Unwrap returns the decoding error
+func (e DecodeError) Unwrap() error {
+	return e.Err
+}
+
+//ClassifyError returns the category of an error returned by the repository, "" for nil
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) && commandErr.IsMaxTimeMSExpiredError() {
+		return ErrorMaxTimeMSExpired
+	}
+	var writeErr mongo.WriteException
+	var bulkErr mongo.BulkWriteException
+	var concernErr *mongo.WriteConcernError
+	if errors.As(err, &writeErr) {
+		concernErr = writeErr.WriteConcernError
+	} else if errors.As(err, &bulkErr) {
+		concernErr = bulkErr.WriteConcernError
+	}
+	if concernErr != nil && isMaxTimeMSExpired(concernErr) {
+		return ErrorMaxTimeMSExpired
+	}
+	if concernErr != nil && concernErr.Code == writeConcernFailedCode {
+		return ErrorWriteConcernTimeout
+	}
+	if errors.As(err, &topology.WaitQueueTimeoutError{}) {
+		return ErrorPoolCheckoutTimeout
+	}
+	if errors.Is(err, topology.ErrServerSelectionTimeout) {
+		return ErrorServerSelectionTimeout
+	}
+	if errors.Is(err, context.Canceled) {
+		return ErrorCancelled
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrDeadlineWouldBeExceeded) {
+		return ErrorClientDeadline
+	}
+	if mongo.IsNetworkError(err) {
+		if mongo.IsTimeout(err) {
+			return ErrorSocketTimeout
+		}
+		return ErrorNetwork
+	}
+	var bsonErr *bsoncodec.DecodeError
+	if errors.As(err, &DecodeError{}) || errors.As(err, &bsonErr) || errors.As(err, &bsoncodec.ValueDecoderError{}) {
+		return ErrorDecode
+	}
+	if errors.As(err, &writeErr) || errors.As(err, &bulkErr) {
+		return ErrorWrite
+	}
+	var serverErr mongo.ServerError
+	if errors.As(err, &serverErr) {
+		return ErrorServer
+	}
+	return ErrorOther
+}
+
+//isMaxTimeMSExpired tells if the write concern failed because it ran past its maxTimeMS
+func isMaxTimeMSExpired(concernErr *mongo.WriteConcernError) bool {
+	return concernErr.Code == maxTimeMSExpiredCode || concernErr.Name == "MaxTimeMSExpired"
+}
+
+//IsTimeoutCategory tells if the category is one of the timeouts
+func IsTimeoutCategory(category string) bool {
+	switch category {
+	case ErrorMaxTimeMSExpired, ErrorSocketTimeout, ErrorPoolCheckoutTimeout, ErrorServerSelectionTimeout, ErrorClientDeadline,
+		ErrorWriteConcernTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		category string
+	}{
+		{"nil", nil, ""},
+		{"max time", mongo.CommandError{Code: 50, Name: "MaxTimeMSExpired"}, ErrorMaxTimeMSExpired},
+		{"wrapped max time", fmt.Errorf("find: %w", mongo.CommandError{Code: 50}), ErrorMaxTimeMSExpired},
+		{"write concern max time", mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 50}}, ErrorMaxTimeMSExpired},
+		{"write concern timeout", mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: writeConcernFailedCode}}, ErrorWriteConcernTimeout},
+		{"bulk write concern timeout", mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: writeConcernFailedCode}}, ErrorWriteConcernTimeout},
+		{"pool checkout", topology.WaitQueueTimeoutError{}, ErrorPoolCheckoutTimeout},
+		{"server selection", fmt.Errorf("selecting: %w", topology.ErrServerSelectionTimeout), ErrorServerSelectionTimeout},
+		{"cancelled", context.Canceled, ErrorCancelled},
+		{"deadline", context.DeadlineExceeded, ErrorClientDeadline},
+		{"deadline would be exceeded", driver.ErrDeadlineWouldBeExceeded, ErrorClientDeadline},
+		{"socket timeout", mongo.CommandError{Labels: []string{"NetworkError", "NetworkTimeoutError"}}, ErrorSocketTimeout},
+		{"network error on a deadline", mongo.CommandError{Labels: []string{"NetworkError"}, Wrapped: context.DeadlineExceeded}, ErrorClientDeadline},
+		{"network", mongo.CommandError{Labels: []string{"NetworkError"}}, ErrorNetwork},
+		{"decode", DecodeError{Err: errors.New("bad document")}, ErrorDecode},
+		{"bson decode", &bsoncodec.DecodeError{}, ErrorDecode},
+		{"write", mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}, ErrorWrite},
+		{"bulk write", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{}}}, ErrorWrite},
+		{"server", mongo.CommandError{Code: 2, Name: "BadValue"}, ErrorServer},
+		{"other", errors.New("unexpected"), ErrorOther},
+	}
+	for _, test := range tests {
+		if category := ClassifyError(test.err); category != test.category {
+			t.Errorf("%s: got %q, want %q", test.name, category, test.category)
+		}
+	}
+}
+
+func TestIsTimeoutCategory(t *testing.T) {
+	for _, category := range []string{ErrorMaxTimeMSExpired, ErrorSocketTimeout, ErrorPoolCheckoutTimeout,
+		ErrorServerSelectionTimeout, ErrorClientDeadline, ErrorWriteConcernTimeout} {
+		if !IsTimeoutCategory(category) {
+			t.Errorf("%s: expected a timeout", category)
+		}
+	}
+	for _, category := range []string{ErrorNetwork, ErrorDecode, ErrorWrite, ErrorServer, ErrorCancelled, ErrorOther, ""} {
+		if IsTimeoutCategory(category) {
+			t.Errorf("%s: expected no timeout", category)
+		}
+	}
+}
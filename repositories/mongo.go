@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math/rand"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -13,7 +15,7 @@ import (
 	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
 )
 
 //MongoDBConfiguration struct
@@ -25,30 +27,68 @@ type MongoDBConfiguration struct {
 	MaxPool        uint64
 	IdleTimeout    time.Duration
 	SocketTimeout  time.Duration
+	WriteConcern   *WriteConcernConfiguration
+	ReadPreference *ReadPreferenceConfiguration
+	ReadConcern    string
+}
+
+//WriteConcernConfiguration struct, W is the number of nodes, "majority" or the name of a tag set
+type WriteConcernConfiguration struct {
+	W        string
+	J        *bool
+	WTimeout time.Duration
+}
+
+//Monitors groups the driver event monitors attached to the client
+type Monitors struct {
+	Pool    *event.PoolMonitor
+	Command *event.CommandMonitor
+	Server  *event.ServerMonitor
 }
 
 type mongoRepository struct {
 	client           *mongo.Client
 	storesCollection *mongo.Collection
-	queryCount       int64
-	validIds         []string
+	*repositoryState
+}
+
+//repositoryState is shared by the repositories created with WithReadOptions
+type repositoryState struct {
+	queryCount  int64
+	validIds    []string
+	insertedIds []string
+	mutex       sync.Mutex
 }
 
 //TestRepository interface
 type TestRepository interface {
-	GetStores(uint, uint, int32) ([]Store, float64, error)
-	Insert([]Store) error
-	Count() (int64, error)
+	GetStores(context.Context, uint, uint, int32) ([]Store, float64, error)
+	FindStore(context.Context, uint) (float64, error)
+	FindOneStore(context.Context, uint) (float64, error)
+	ScanStores(context.Context, uint, uint, int32) (float64, error)
+	AggregateStores(context.Context, uint, uint, int32) (float64, error)
+	CountStores(context.Context, uint, uint) (float64, error)
+	DistinctNames(context.Context, uint, uint) (float64, error)
+	UpdateStore(context.Context, string) (float64, error)
+	UpsertStore(context.Context, Store) (float64, error)
+	InsertStore(context.Context, Store) (float64, error)
+	IncrementStore(context.Context) (float64, error)
+	ReplaceStore(context.Context, Store) (float64, error)
+	BulkWriteStores(context.Context, []Store) (float64, error)
+	DeleteStore(context.Context) (float64, error)
+	Insert(context.Context, []Store) error
+	Count(context.Context) (int64, error)
 	QueryCount() int64
 	Close()
 	Clear()
 	SetValidIds([]string)
+	WithReadOptions(*ReadPreferenceConfiguration, string) (TestRepository, error)
 }
 
 //NewMongodbRepository creates a new client, database and collection
-func NewMongodbRepository(config *MongoDBConfiguration, monitorFunc func(*event.PoolEvent)) (TestRepository, error) {
+func NewMongodbRepository(ctx context.Context, config *MongoDBConfiguration, monitors Monitors) (TestRepository, error) {
 
-	client, err := CreateClient(config, monitorFunc)
+	client, err := CreateClient(ctx, config, monitors)
 
 	if err != nil {
 		return nil, err
@@ -59,6 +99,7 @@ func NewMongodbRepository(config *MongoDBConfiguration, monitorFunc func(*event.
 	repository := &mongoRepository{
 		client:           client,
 		storesCollection: database.Collection(config.CollectionName),
+		repositoryState:  &repositoryState{},
 	}
 
 	logrus.Info("A MongoDBRepository was initialized")
@@ -66,26 +107,45 @@ func NewMongodbRepository(config *MongoDBConfiguration, monitorFunc func(*event.
 }
 
 //CreateClient creates a new MongoDB connection client
-func CreateClient(config *MongoDBConfiguration, monitorFunc func(*event.PoolEvent)) (*mongo.Client, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10000*time.Second)
+func CreateClient(ctx context.Context, config *MongoDBConfiguration, monitors Monitors) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10000*time.Second)
 	defer cancel()
+	readPref, err := config.ReadPreference.ReadPref()
+	if err != nil {
+		return nil, err
+	}
+	readConcern, err := NewReadConcern(config.ReadConcern)
+	if err != nil {
+		return nil, err
+	}
 	clientOptions := options.Client().ApplyURI(config.ConnString).
-		SetReadPreference(readpref.SecondaryPreferred()).
+		SetReadPreference(readPref).
 		SetMaxConnIdleTime(config.IdleTimeout).
 		SetMaxPoolSize(config.MaxPool).
 		SetMinPoolSize(config.MinPool).
-		SetSocketTimeout(config.SocketTimeout).
-		SetPoolMonitor(
-			&event.PoolMonitor{
-				Event: monitorFunc,
-			})
+		SetSocketTimeout(config.SocketTimeout)
+	if readConcern != nil {
+		clientOptions.SetReadConcern(readConcern)
+	}
+	if config.WriteConcern != nil {
+		clientOptions.SetWriteConcern(config.WriteConcern.writeConcern())
+	}
+	if monitors.Pool != nil {
+		clientOptions.SetPoolMonitor(monitors.Pool)
+	}
+	if monitors.Command != nil {
+		clientOptions.SetMonitor(monitors.Command)
+	}
+	if monitors.Server != nil {
+		clientOptions.SetServerMonitor(monitors.Server)
+	}
 
 	db, err := mongo.Connect(ctx, clientOptions)
 
 	if err != nil {
 		return nil, err
 	}
-	er := db.Ping(ctx, readpref.SecondaryPreferred())
+	er := db.Ping(ctx, readPref)
 	if clientOptions.Auth != nil {
 		if clientOptions.Auth.AuthSource != "" {
 			config.DbName = clientOptions.Auth.AuthSource
@@ -93,6 +153,7 @@ func CreateClient(config *MongoDBConfiguration, monitorFunc func(*event.PoolEven
 	}
 
 	if er != nil {
+		_ = db.Disconnect(context.Background())
 		return nil, er
 	}
 
@@ -103,6 +164,24 @@ func CreateClient(config *MongoDBConfiguration, monitorFunc func(*event.PoolEven
 	return db, nil
 }
 
+func (w *WriteConcernConfiguration) writeConcern() *writeconcern.WriteConcern {
+	var concernOptions []writeconcern.Option
+	if w.J != nil {
+		concernOptions = append(concernOptions, writeconcern.J(*w.J))
+	}
+	if w.WTimeout > 0 {
+		concernOptions = append(concernOptions, writeconcern.WTimeout(w.WTimeout))
+	}
+	if nodes, err := strconv.Atoi(w.W); err == nil {
+		concernOptions = append(concernOptions, writeconcern.W(nodes))
+	} else if w.W == "majority" {
+		concernOptions = append(concernOptions, writeconcern.WMajority())
+	} else if w.W != "" {
+		concernOptions = append(concernOptions, writeconcern.WTagSet(w.W))
+	}
+	return writeconcern.New(concernOptions...)
+}
+
 func ensureIndex(col *mongo.Collection) error {
 	idxs, err := col.Indexes().List(context.TODO())
 	idxName := "store_id_ux"
@@ -128,7 +207,7 @@ func ensureIndex(col *mongo.Collection) error {
 	return nil
 }
 
-func (m *mongoRepository) GetStores(size uint, timeout uint, batchSize int32) ([]Store, float64, error) {
+func (m *mongoRepository) GetStores(ctx context.Context, size uint, timeout uint, batchSize int32) ([]Store, float64, error) {
 
 	now := time.Now()
 	nsecStart := now.UnixNano()
@@ -144,8 +223,6 @@ func (m *mongoRepository) GetStores(size uint, timeout uint, batchSize int32) ([
 
 	filter := bson.M{"store_id": bson.M{"$in": idsList}}
 
-	ctx := context.Background()
-
 	atomic.AddInt64(&m.queryCount, 1)
 
 	fOptions := &options.FindOptions{}
@@ -166,13 +243,16 @@ func (m *mongoRepository) GetStores(size uint, timeout uint, batchSize int32) ([
 	}
 
 	var stores []Store
-	err = records.All(ctx, &stores)
-	if err != nil {
-
-		if records != nil {
+	for records.Next(ctx) {
+		var store Store
+		if err = records.Decode(&store); err != nil {
 			_ = records.Close(ctx)
+			return nil, calculateTime(nsecStart), DecodeError{Err: err}
 		}
-
+		stores = append(stores, store)
+	}
+	if err = records.Err(); err != nil {
+		_ = records.Close(ctx)
 		return nil, calculateTime(nsecStart), err
 	}
 
@@ -190,7 +270,7 @@ func calculateTime(start int64) float64 {
 	return elapsedTimeMS
 }
 
-func (m *mongoRepository) Insert(stores []Store) error {
+func (m *mongoRepository) Insert(ctx context.Context, stores []Store) error {
 
 	var operations []mongo.WriteModel
 
@@ -200,16 +280,16 @@ func (m *mongoRepository) Insert(stores []Store) error {
 		})
 	}
 
-	_, err := m.storesCollection.BulkWrite(context.Background(), operations)
+	_, err := m.storesCollection.BulkWrite(ctx, operations)
 	return err
 }
 
-func (m *mongoRepository) Count() (int64, error) {
-	return m.storesCollection.CountDocuments(context.TODO(), bson.M{})
+func (m *mongoRepository) Count(ctx context.Context) (int64, error) {
+	return m.storesCollection.CountDocuments(ctx, bson.M{})
 }
 
 func (m *mongoRepository) QueryCount() int64 {
-	return m.queryCount
+	return atomic.LoadInt64(&m.queryCount)
 }
 
 func (m *mongoRepository) Close() {
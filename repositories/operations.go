@@ -0,0 +1,242 @@
+package repositories
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//FindStore looks up a single random store by store_id through a cursor
+func (m *mongoRepository) FindStore(ctx context.Context, timeout uint) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	fOptions := options.Find().SetMaxTime(time.Duration(timeout) * time.Millisecond)
+
+	records, err := m.storesCollection.Find(ctx, bson.M{"store_id": m.randomID()}, fOptions)
+	if err != nil {
+		return calculateTime(nsecStart), err
+	}
+	return calculateTime(nsecStart), drain(ctx, records)
+}
+
+//FindOneStore looks up a single random store by store_id with FindOne
+func (m *mongoRepository) FindOneStore(ctx context.Context, timeout uint) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	fOptions := options.FindOne().SetMaxTime(time.Duration(timeout) * time.Millisecond)
+
+	var store Store
+	err := m.storesCollection.FindOne(ctx, bson.M{"store_id": m.randomID()}, fOptions).Decode(&store)
+	if err == mongo.ErrNoDocuments {
+		err = nil
+	}
+	return calculateTime(nsecStart), err
+}
+
+//ScanStores reads up to limit stores sorted by store_id, starting at a random one
+func (m *mongoRepository) ScanStores(ctx context.Context, limit uint, timeout uint, batchSize int32) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	fOptions := options.Find().
+		SetMaxTime(time.Duration(timeout) * time.Millisecond).
+		SetSort(bson.M{"store_id": 1}).
+		SetLimit(int64(limit))
+	if batchSize != 0 {
+		fOptions.SetBatchSize(batchSize)
+	}
+
+	records, err := m.storesCollection.Find(ctx, bson.M{"store_id": bson.M{"$gte": m.randomID()}}, fOptions)
+	if err != nil {
+		return calculateTime(nsecStart), err
+	}
+	return calculateTime(nsecStart), drain(ctx, records)
+}
+
+//AggregateStores groups size random stores in an aggregation pipeline
+func (m *mongoRepository) AggregateStores(ctx context.Context, size uint, timeout uint, batchSize int32) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"store_id": bson.M{"$in": m.randomIDs(size)}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$name", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$sort", Value: bson.M{"count": -1}}},
+	}
+	aOptions := options.Aggregate().SetMaxTime(time.Duration(timeout) * time.Millisecond)
+	if batchSize != 0 {
+		aOptions.SetBatchSize(batchSize)
+	}
+
+	records, err := m.storesCollection.Aggregate(ctx, pipeline, aOptions)
+	if err != nil {
+		return calculateTime(nsecStart), err
+	}
+	return calculateTime(nsecStart), drain(ctx, records)
+}
+
+//CountStores counts size random stores
+func (m *mongoRepository) CountStores(ctx context.Context, size uint, timeout uint) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	cOptions := options.Count().SetMaxTime(time.Duration(timeout) * time.Millisecond)
+
+	_, err := m.storesCollection.CountDocuments(ctx, bson.M{"store_id": bson.M{"$in": m.randomIDs(size)}}, cOptions)
+	return calculateTime(nsecStart), err
+}
+
+//DistinctNames returns the distinct names of size random stores
+func (m *mongoRepository) DistinctNames(ctx context.Context, size uint, timeout uint) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	dOptions := options.Distinct().SetMaxTime(time.Duration(timeout) * time.Millisecond)
+
+	_, err := m.storesCollection.Distinct(ctx, "name", bson.M{"store_id": bson.M{"$in": m.randomIDs(size)}}, dOptions)
+	return calculateTime(nsecStart), err
+}
+
+//UpdateStore sets a new name to a random store
+func (m *mongoRepository) UpdateStore(ctx context.Context, name string) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	_, err := m.storesCollection.UpdateOne(ctx,
+		bson.M{"store_id": m.randomID()},
+		bson.M{"$set": bson.M{"name": name}})
+	return calculateTime(nsecStart), err
+}
+
+//UpsertStore updates the store or inserts it when it does not exist
+func (m *mongoRepository) UpsertStore(ctx context.Context, store Store) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	result, err := m.storesCollection.UpdateOne(ctx,
+		bson.M{"store_id": store.StoreId},
+		bson.M{"$set": bson.M{"name": store.Name, "hugeValue": store.HugeValue}},
+		options.Update().SetUpsert(true))
+	if err == nil && result.UpsertedCount > 0 {
+		m.addInsertedID(store.StoreId)
+	}
+	return calculateTime(nsecStart), err
+}
+
+//InsertStore inserts a single store
+func (m *mongoRepository) InsertStore(ctx context.Context, store Store) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	_, err := m.storesCollection.InsertOne(ctx, bson.M{"store_id": store.StoreId, "name": store.Name, "hugeValue": store.HugeValue})
+	if err == nil {
+		m.addInsertedID(store.StoreId)
+	}
+	return calculateTime(nsecStart), err
+}
+
+//IncrementStore increments the visits of a random store
+func (m *mongoRepository) IncrementStore(ctx context.Context) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	_, err := m.storesCollection.UpdateOne(ctx,
+		bson.M{"store_id": m.randomID()},
+		bson.M{"$inc": bson.M{"visits": 1}})
+	return calculateTime(nsecStart), err
+}
+
+//ReplaceStore replaces a random store with the name and value of store, the store_id is kept
+func (m *mongoRepository) ReplaceStore(ctx context.Context, store Store) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	storeID := m.randomID()
+	_, err := m.storesCollection.ReplaceOne(ctx,
+		bson.M{"store_id": storeID},
+		bson.M{"store_id": storeID, "name": store.Name, "hugeValue": store.HugeValue})
+	return calculateTime(nsecStart), err
+}
+
+//BulkWriteStores inserts the stores and increments the visits of a random store for each one, in a single unordered bulk write
+func (m *mongoRepository) BulkWriteStores(ctx context.Context, stores []Store) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	operations := make([]mongo.WriteModel, 0, 2*len(stores))
+	for _, store := range stores {
+		operations = append(operations,
+			mongo.NewInsertOneModel().SetDocument(bson.M{"store_id": store.StoreId, "name": store.Name, "hugeValue": store.HugeValue}),
+			mongo.NewUpdateOneModel().SetFilter(bson.M{"store_id": m.randomID()}).SetUpdate(bson.M{"$inc": bson.M{"visits": 1}}))
+	}
+
+	result, err := m.storesCollection.BulkWrite(ctx, operations, options.BulkWrite().SetOrdered(false))
+	if result != nil && result.InsertedCount == int64(len(stores)) {
+		for _, store := range stores {
+			m.addInsertedID(store.StoreId)
+		}
+	}
+	return calculateTime(nsecStart), err
+}
+
+//DeleteStore deletes one of the stores inserted during the test, the seeded stores are kept
+//so the reads keep finding documents. When there is none left the delete matches nothing
+func (m *mongoRepository) DeleteStore(ctx context.Context) (float64, error) {
+	nsecStart := time.Now().UnixNano()
+	atomic.AddInt64(&m.queryCount, 1)
+
+	_, err := m.storesCollection.DeleteOne(ctx, bson.M{"store_id": m.popInsertedID()})
+	return calculateTime(nsecStart), err
+}
+
+func (m *mongoRepository) randomID() string {
+	return m.validIds[rand.Intn(len(m.validIds))]
+}
+
+func (m *mongoRepository) randomIDs(size uint) bson.A {
+	ids := make(bson.A, 0, size)
+	for i := 0; i < int(size); i++ {
+		ids = append(ids, m.randomID())
+	}
+	return ids
+}
+
+func (m *mongoRepository) addInsertedID(id string) {
+	m.mutex.Lock()
+	m.insertedIds = append(m.insertedIds, id)
+	m.mutex.Unlock()
+}
+
+func (m *mongoRepository) popInsertedID() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.insertedIds) == 0 {
+		return ""
+	}
+	id := m.insertedIds[len(m.insertedIds)-1]
+	m.insertedIds = m.insertedIds[:len(m.insertedIds)-1]
+	return id
+}
+
+//drain reads and discards every document of the cursor
+func drain(ctx context.Context, records *mongo.Cursor) error {
+	defer func() {
+		_ = records.Close(ctx)
+	}()
+
+	for records.Next(ctx) {
+		var document bson.Raw
+		if err := records.Decode(&document); err != nil {
+			return DecodeError{Err: err}
+		}
+	}
+	return records.Err()
+}
@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+//DefaultReadPreference is used when the configuration has none
+const DefaultReadPreference = "secondaryPreferred"
+
+//minMaxStaleness is the smallest max staleness accepted by the servers
+const minMaxStaleness = 90 * time.Second
+
+//ReadPreferenceConfiguration struct
+type ReadPreferenceConfiguration struct {
+	Mode         string
+	TagSets      []map[string]string
+	MaxStaleness time.Duration
+}
+
+//ReadPref builds the driver read preference, nil means secondaryPreferred
+func (r *ReadPreferenceConfiguration) ReadPref() (*readpref.ReadPref, error) {
+	if r == nil {
+		return readpref.SecondaryPreferred(), nil
+	}
+	mode, err := readpref.ModeFromString(r.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	var readPrefOptions []readpref.Option
+	if len(r.TagSets) > 0 {
+		readPrefOptions = append(readPrefOptions, readpref.WithTagSets(tag.NewTagSetsFromMaps(r.TagSets)...))
+	}
+	if r.MaxStaleness > 0 && r.MaxStaleness < minMaxStaleness {
+		return nil, fmt.Errorf("max staleness must be at least %v", minMaxStaleness)
+	}
+	if r.MaxStaleness > 0 {
+		readPrefOptions = append(readPrefOptions, readpref.WithMaxStaleness(r.MaxStaleness))
+	}
+	readPref, err := readpref.New(mode, readPrefOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("read preference %s: %v", r.Mode, err)
+	}
+	return readPref, nil
+}
+
+//NewReadConcern builds the driver read concern, nil for an empty level (server default)
+func NewReadConcern(level string) (*readconcern.ReadConcern, error) {
+	switch level {
+	case "":
+		return nil, nil
+	case "local", "majority", "available", "linearizable", "snapshot":
+		return readconcern.New(readconcern.Level(level)), nil
+	}
+	return nil, fmt.Errorf("unknown read concern %s", level)
+}
+
+//WithReadOptions returns a repository sharing the client and the counters that reads with the given
+//preference and concern, nil and "" keep the ones of the client
+func (m *mongoRepository) WithReadOptions(readPreference *ReadPreferenceConfiguration, readConcern string) (TestRepository, error) {
+	collectionOptions := options.Collection()
+	if readPreference != nil {
+		readPref, err := readPreference.ReadPref()
+		if err != nil {
+			return nil, err
+		}
+		collectionOptions.SetReadPreference(readPref)
+	}
+	concern, err := NewReadConcern(readConcern)
+	if err != nil {
+		return nil, err
+	}
+	if concern != nil {
+		collectionOptions.SetReadConcern(concern)
+	}
+
+	collection, err := m.storesCollection.Clone(collectionOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoRepository{
+		client:           m.client,
+		storesCollection: collection,
+		repositoryState:  m.repositoryState,
+	}, nil
+}
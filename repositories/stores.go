@@ -6,4 +6,5 @@ type Store struct {
 	StoreId   string `bson:"store_id"`
 	Name      string
 	HugeValue string
+	Visits    int64 `bson:"visits,omitempty"`
 }
@@ -0,0 +1,319 @@
+package scenario
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//NewStage validates the config and builds its stage, the failed validations are returned when it is not valid
+func NewStage(testConfig TestConfig) (*stage.Stage, []string) {
+	if result := validate(&testConfig); len(result) > 0 {
+		return nil, result
+	}
+
+	return stage.New(
+		repositories.MongoDBConfiguration{
+			DbName:         testConfig.DBConfig.DbName,
+			CollectionName: testConfig.DBConfig.CollectionName,
+			ConnString:     testConfig.DBConfig.ConnString,
+			MinPool:        uint64(testConfig.DBConfig.MinPoolSize),
+			MaxPool:        uint64(testConfig.DBConfig.MaxPoolSize),
+			IdleTimeout:    time.Duration(testConfig.DBConfig.IdleTimeout) * time.Second,
+			SocketTimeout:  time.Duration(testConfig.DBConfig.SocketTimeout) * time.Second,
+			WriteConcern:   writeConcern(testConfig.DBConfig.WriteConcern),
+			ReadPreference: readPreference(testConfig.DBConfig.ReadPreference).Configuration(),
+			ReadConcern:    testConfig.DBConfig.ReadConcern,
+		}, stage.Config{
+			WorkersCount:     testConfig.StageConfig.WorkersCount,
+			WorkersToAdd:     testConfig.StageConfig.WorkersToAdd,
+			IncrementLoad:    testConfig.StageConfig.IncrementLoad,
+			ProducersCount:   testConfig.StageConfig.ProducersCount,
+			MsgBySec:         testConfig.StageConfig.MsgBySec,
+			TimeToSleepSecs:  testConfig.StageConfig.TimeToSleepSecs,
+			TimeToFinishSecs: testConfig.StageConfig.TimeToFinishSecs,
+			QueryTimeoutMs:   testConfig.StageConfig.QueryTimeoutMs,
+			BatchSize:        int32(testConfig.StageConfig.BatchSize),
+			CollectionSize:   int(testConfig.StageConfig.CollectionSize),
+			DocumentSize:     int(testConfig.StageConfig.DocumentSize),
+			Workload:         workloadItems(testConfig.StageConfig.Workload),
+			LoadModel:        testConfig.StageConfig.LoadModel,
+			TargetRate:       testConfig.StageConfig.TargetRate,
+			LateThresholdMs:  testConfig.StageConfig.LateThresholdMs,
+			LoadProfile:      loadProfile(testConfig.StageConfig.LoadProfile),
+			Search:           searchConfig(testConfig.StageConfig.Search),
+			SLOs:             testConfig.StageConfig.SLOs,
+			Tags:             testConfig.StageConfig.Tags,
+		}), nil
+}
+
+//Parse reads the config of a single stage in YAML or JSON
+func Parse(content []byte) (TestConfig, error) {
+	var testConfig TestConfig
+	err := decodeYAML(content, &testConfig)
+	return testConfig, err
+}
+
+//validate returns the failed validations of the config, none when it is valid
+func validate(testConfig *TestConfig) []string {
+	var result []string
+
+	if isEmpty(testConfig.DBConfig.DbName) {
+		result = append(result, "Database' name is required")
+	}
+	if isEmpty(testConfig.DBConfig.ConnString) {
+		result = append(result, "Connection string is required")
+	}
+	if isEmpty(testConfig.DBConfig.CollectionName) {
+		result = append(result, "Collection name is required")
+	}
+	if isEmptyNumber(testConfig.DBConfig.MaxPoolSize) {
+		result = append(result, "MaxPoolSize is required")
+	}
+	if isEmptyNumber(testConfig.DBConfig.SocketTimeout) {
+		result = append(result, "Socket' timeout is required")
+	}
+	if concern := testConfig.DBConfig.WriteConcern; concern != nil {
+		if _, ok := writeConcernW(concern.W); !ok {
+			result = append(result, "Write concern' w must be a number of nodes, majority or a tag set name")
+		}
+	}
+	if _, err := readPreference(testConfig.DBConfig.ReadPreference).Configuration().ReadPref(); err != nil {
+		result = append(result, "Invalid read preference: "+err.Error())
+	}
+	if _, err := repositories.NewReadConcern(testConfig.DBConfig.ReadConcern); err != nil {
+		result = append(result, "Invalid read concern: "+err.Error())
+	}
+	if isEmptyNumber(testConfig.StageConfig.WorkersCount) {
+		result = append(result, "Workers count is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.QueryTimeoutMs) {
+		result = append(result, "Query' timeout is required")
+	}
+	//the queries pick their documents among the seeded ones
+	if isEmptyNumber(testConfig.StageConfig.CollectionSize) {
+		result = append(result, "Collection size is required")
+	}
+	//the load profile and the search replace the workers added every time to sleep
+	withProfile := len(testConfig.StageConfig.LoadProfile) > 0 || testConfig.StageConfig.Search != nil
+	if isEmptyNumber(testConfig.StageConfig.WorkersToAdd) && !withProfile {
+		result = append(result, "Workers to add is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.IncrementLoad) && !withProfile {
+		result = append(result, "Increment load is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.MsgBySec) {
+		result = append(result, "Messages per second is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.ProducersCount) {
+		result = append(result, "Producers' count is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.TimeToSleepSecs) && !withProfile {
+		result = append(result, "Time to sleep is required")
+	}
+	if isEmptyNumber(testConfig.StageConfig.TimeToFinishSecs) && !withProfile {
+		result = append(result, "Time to finish is required")
+	}
+	if testConfig.StageConfig.Search != nil && len(testConfig.StageConfig.LoadProfile) > 0 {
+		result = append(result, "Search and load profile can not be used together")
+	}
+	if err := stage.ValidateSearch(searchConfig(testConfig.StageConfig.Search)); err != nil {
+		result = append(result, "Invalid search: "+err.Error())
+	}
+	if err := stage.ValidateProfile(loadProfile(testConfig.StageConfig.LoadProfile)); err != nil {
+		result = append(result, "Invalid load profile: "+err.Error())
+	}
+	if model := testConfig.StageConfig.LoadModel; model != "" && model != stage.LoadModelClosed && model != stage.LoadModelOpen {
+		result = append(result, "Load model must be closed or open")
+	}
+	if _, err := stage.NewWorkload(workloadItems(testConfig.StageConfig.Workload)); err != nil {
+		result = append(result, "Invalid workload: "+err.Error())
+	}
+	if err := stage.ValidateAssertions(testConfig.StageConfig.SLOs); err != nil {
+		result = append(result, "Invalid SLO: "+err.Error())
+	}
+
+	return result
+}
+
+func writeConcern(concern *WriteConcern) *repositories.WriteConcernConfiguration {
+	if concern == nil {
+		return nil
+	}
+	w, _ := writeConcernW(concern.W)
+	return &repositories.WriteConcernConfiguration{
+		W:        w,
+		J:        concern.J,
+		WTimeout: time.Duration(concern.WTimeout) * time.Millisecond,
+	}
+}
+
+//writeConcernW accepts the w of the write concern as a JSON number or string
+func writeConcernW(value interface{}) (string, bool) {
+	switch w := value.(type) {
+	case nil:
+		return "", true
+	case float64:
+		if w < 0 || w != math.Trunc(w) {
+			return "", false
+		}
+		return strconv.Itoa(int(w)), true
+	case string:
+		return w, !isEmpty(w)
+	}
+	return "", false
+}
+
+func readPreference(preference *ReadPreference) *stage.ReadPreference {
+	if preference == nil {
+		return nil
+	}
+	return &stage.ReadPreference{
+		Mode:                preference.Mode,
+		TagSets:             preference.TagSets,
+		MaxStalenessSeconds: preference.MaxStalenessSeconds,
+	}
+}
+
+func searchConfig(search *SearchConfig) *stage.SearchConfig {
+	if search == nil {
+		return nil
+	}
+	return &stage.SearchConfig{
+		Variable:           search.Variable,
+		Start:              search.Start,
+		Step:               search.Step,
+		Max:                search.Max,
+		StepDurationSecs:   search.StepDurationSecs,
+		MaxP99Ms:           search.MaxP99Ms,
+		MaxErrorPercentage: search.MaxErrorPercentage,
+		PoolSizes:          search.PoolSizes,
+	}
+}
+
+func loadProfile(profile []ProfilePhase) []stage.ProfilePhase {
+	var phases []stage.ProfilePhase
+	for _, phase := range profile {
+		phases = append(phases, stage.ProfilePhase{
+			Name:         phase.Name,
+			Shape:        phase.Shape,
+			DurationSecs: phase.DurationSecs,
+			Workers:      phase.Workers,
+			Rate:         phase.Rate,
+		})
+	}
+	return phases
+}
+
+func workloadItems(workload []WorkloadItem) []stage.WorkloadItem {
+	var items []stage.WorkloadItem
+	for _, item := range workload {
+		items = append(items, stage.WorkloadItem{
+			Operation:      item.Operation,
+			Weight:         item.Weight,
+			Size:           item.Size,
+			ReadPreference: readPreference(item.ReadPreference),
+			ReadConcern:    item.ReadConcern,
+		})
+	}
+	return items
+}
+
+func isEmpty(value string) bool {
+	return strings.TrimSpace(value) == ""
+}
+
+func isEmptyNumber(value uint) bool {
+	return value == 0
+}
+
+//TestConfig struct
+type TestConfig struct {
+	DBConfig    DBConfig    `json:"db_config"`
+	StageConfig StageConfig `json:"stage_config"`
+}
+
+//DBConfig struct
+type DBConfig struct {
+	DbName         string          `json:"db_name"`
+	CollectionName string          `json:"collection_name"`
+	ConnString     string          `json:"conn_string"`
+	MinPoolSize    uint            `json:"min_pool_size"`
+	MaxPoolSize    uint            `json:"max_pool_size"`
+	IdleTimeout    uint            `json:"idle_timeout"`
+	SocketTimeout  uint            `json:"socket_timeout"`
+	WriteConcern   *WriteConcern   `json:"write_concern"`
+	ReadPreference *ReadPreference `json:"read_preference"`
+	ReadConcern    string          `json:"read_concern"`
+}
+
+//ReadPreference struct
+type ReadPreference struct {
+	Mode                string              `json:"mode"`
+	TagSets             []map[string]string `json:"tag_sets"`
+	MaxStalenessSeconds uint                `json:"max_staleness_seconds"`
+}
+
+//WriteConcern struct
+type WriteConcern struct {
+	W        interface{} `json:"w"`
+	J        *bool       `json:"j"`
+	WTimeout uint        `json:"wtimeout"`
+}
+
+//StageConfig struct
+type StageConfig struct {
+	WorkersCount     uint           `json:"workers_count"`
+	WorkersToAdd     uint           `json:"workers_to_add"`
+	IncrementLoad    uint           `json:"increment_load"`
+	ProducersCount   uint           `json:"producers_count"`
+	MsgBySec         uint           `json:"msg_by_sec"`
+	TimeToSleepSecs  uint           `json:"time_to_sleep_secs"`
+	TimeToFinishSecs uint           `json:"time_to_finish_secs"`
+	QueryTimeoutMs   uint           `json:"query_timeout_ms"`
+	BatchSize        uint           `json:"batch_size"`
+	CollectionSize   uint           `json:"collection_size"`
+	DocumentSize     uint           `json:"document_size_kb"`
+	Workload         []WorkloadItem `json:"workload"`
+	LoadModel        string         `json:"load_model"`
+	TargetRate       uint           `json:"target_rate"`
+	LateThresholdMs  uint           `json:"late_threshold_ms"`
+	LoadProfile      []ProfilePhase `json:"load_profile"`
+	Search           *SearchConfig  `json:"search"`
+	SLOs             []string       `json:"slos"`
+	Tags             []string       `json:"tags"`
+}
+
+//SearchConfig struct
+type SearchConfig struct {
+	Variable           string  `json:"variable"`
+	Start              uint    `json:"start"`
+	Step               uint    `json:"step"`
+	Max                uint    `json:"max"`
+	StepDurationSecs   uint    `json:"step_duration_secs"`
+	MaxP99Ms           float64 `json:"max_p99_ms"`
+	MaxErrorPercentage float64 `json:"max_error_percentage"`
+	PoolSizes          []uint  `json:"pool_sizes"`
+}
+
+//ProfilePhase struct
+type ProfilePhase struct {
+	Name         string `json:"name"`
+	Shape        string `json:"shape"`
+	DurationSecs uint   `json:"duration_secs"`
+	Workers      uint   `json:"workers"`
+	Rate         uint   `json:"rate"`
+}
+
+//WorkloadItem struct
+type WorkloadItem struct {
+	Operation      string          `json:"operation"`
+	Weight         uint            `json:"weight"`
+	Size           uint            `json:"size"`
+	ReadPreference *ReadPreference `json:"read_preference"`
+	ReadConcern    string          `json:"read_concern"`
+}
@@ -0,0 +1,147 @@
+package scenario
+
+import (
+	"strings"
+	"testing"
+)
+
+func validScenario() TestConfig {
+	return TestConfig{
+		DBConfig: DBConfig{
+			DbName:         "test",
+			CollectionName: "stores",
+			ConnString:     "mongodb://localhost:27017",
+			MaxPoolSize:    10,
+			SocketTimeout:  5,
+		},
+		StageConfig: StageConfig{
+			WorkersCount:     2,
+			WorkersToAdd:     2,
+			IncrementLoad:    2,
+			ProducersCount:   1,
+			MsgBySec:         100,
+			TimeToSleepSecs:  5,
+			TimeToFinishSecs: 10,
+			QueryTimeoutMs:   500,
+			CollectionSize:   100,
+		},
+	}
+}
+
+func hasValidation(validations []string, text string) bool {
+	for _, validation := range validations {
+		if strings.Contains(validation, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNewStage(t *testing.T) {
+	stageImpl, validations := NewStage(validScenario())
+	if len(validations) > 0 {
+		t.Fatalf("got validations %v", validations)
+	}
+	if stageImpl == nil {
+		t.Fatal("expected a stage")
+	}
+}
+
+func TestValidateRequiredFields(t *testing.T) {
+	validations := validate(&TestConfig{})
+	for _, text := range []string{"Database' name", "Connection string", "Collection name", "MaxPoolSize",
+		"Workers count", "Query' timeout", "Collection size", "Workers to add", "Time to finish"} {
+		if !hasValidation(validations, text) {
+			t.Errorf("missing the %s validation in %v", text, validations)
+		}
+	}
+}
+
+func TestValidateProfileReplacesTheIncrements(t *testing.T) {
+	testConfig := validScenario()
+	testConfig.StageConfig.WorkersToAdd = 0
+	testConfig.StageConfig.IncrementLoad = 0
+	testConfig.StageConfig.TimeToSleepSecs = 0
+	testConfig.StageConfig.TimeToFinishSecs = 0
+	testConfig.StageConfig.LoadProfile = []ProfilePhase{{Shape: "ramp", DurationSecs: 10, Workers: 10}}
+
+	if validations := validate(&testConfig); len(validations) > 0 {
+		t.Errorf("got validations %v", validations)
+	}
+}
+
+func TestValidateSearchWithProfile(t *testing.T) {
+	testConfig := validScenario()
+	testConfig.StageConfig.LoadProfile = []ProfilePhase{{DurationSecs: 10}}
+	testConfig.StageConfig.Search = &SearchConfig{Start: 10, Step: 10, Max: 50, StepDurationSecs: 10, MaxP99Ms: 50}
+
+	if validations := validate(&testConfig); !hasValidation(validations, "Search and load profile") {
+		t.Errorf("got validations %v, want search and load profile rejected", validations)
+	}
+}
+
+func TestValidateInvalidValues(t *testing.T) {
+	tests := map[string]func(*TestConfig){
+		"Write concern":   func(c *TestConfig) { c.DBConfig.WriteConcern = &WriteConcern{W: 1.5} },
+		"read preference": func(c *TestConfig) { c.DBConfig.ReadPreference = &ReadPreference{Mode: "closest"} },
+		"read concern":    func(c *TestConfig) { c.DBConfig.ReadConcern = "strong" },
+		"Load model":      func(c *TestConfig) { c.StageConfig.LoadModel = "mixed" },
+		"workload":        func(c *TestConfig) { c.StageConfig.Workload = []WorkloadItem{{Operation: "missing", Weight: 1}} },
+		"SLO":             func(c *TestConfig) { c.StageConfig.SLOs = []string{"latency < 50"} },
+		"Collection size": func(c *TestConfig) { c.StageConfig.CollectionSize = 0 },
+	}
+	for text, change := range tests {
+		testConfig := validScenario()
+		change(&testConfig)
+		if validations := validate(&testConfig); !hasValidation(validations, text) {
+			t.Errorf("got validations %v, want the %s one", validations, text)
+		}
+	}
+}
+
+func TestWriteConcernW(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		w     string
+		ok    bool
+	}{
+		{nil, "", true},
+		{float64(2), "2", true},
+		{"majority", "majority", true},
+		{float64(-1), "", false},
+		{1.5, "", false},
+		{" ", " ", false},
+		{true, "", false},
+	}
+	for _, test := range tests {
+		if w, ok := writeConcernW(test.value); w != test.w || ok != test.ok {
+			t.Errorf("%v: got %q %v, want %q %v", test.value, w, ok, test.w, test.ok)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	testConfig, err := Parse([]byte(`
+db_config:
+  db_name: test
+  max_pool_size: 10
+stage_config:
+  workers_count: 4
+  load_profile:
+    - shape: ramp
+      duration_secs: 30
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testConfig.DBConfig.DbName != "test" || testConfig.DBConfig.MaxPoolSize != 10 || testConfig.StageConfig.WorkersCount != 4 {
+		t.Errorf("got %+v", testConfig)
+	}
+	if profile := testConfig.StageConfig.LoadProfile; len(profile) != 1 || profile[0].Shape != "ramp" || profile[0].DurationSecs != 30 {
+		t.Errorf("load profile: got %+v", profile)
+	}
+
+	if _, err := Parse([]byte("db_config: [")); err == nil {
+		t.Error("invalid YAML: expected an error")
+	}
+}
@@ -0,0 +1,123 @@
+package scenario
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/andresneva/mongo_driver_test/stage"
+)
+
+//suiteFile is a suite in YAML or JSON: the db_config and stage_config defaults shared by its stages,
+//each stage overrides the fields it sets
+type suiteFile struct {
+	Name        string                 `json:"name"`
+	DBConfig    map[string]interface{} `json:"db_config"`
+	StageConfig map[string]interface{} `json:"stage_config"`
+	Stages      []suiteStageFile       `json:"stages"`
+}
+
+type suiteStageFile struct {
+	Name        string                 `json:"name"`
+	DBConfig    map[string]interface{} `json:"db_config"`
+	StageConfig map[string]interface{} `json:"stage_config"`
+}
+
+//NewSuite parses a suite in YAML or JSON and builds its stages, each with a new id. The failed validations
+//of every stage are returned when one is not valid
+func NewSuite(content []byte) (*stage.Suite, []string, error) {
+	var file suiteFile
+	if err := decodeYAML(content, &file); err != nil {
+		return nil, nil, err
+	}
+	if len(file.Stages) == 0 {
+		return nil, []string{"The suite has no stages"}, nil
+	}
+
+	var validations []string
+	var stages []stage.SuiteStage
+	names := make(map[string]bool)
+	for i, stageFile := range file.Stages {
+		name := stageFile.Name
+		if name == "" {
+			name = fmt.Sprintf("stage %d", i+1)
+		}
+		if names[name] {
+			validations = append(validations, fmt.Sprintf("Stage name %s is repeated", name))
+		}
+		names[name] = true
+
+		var testConfig TestConfig
+		err := remarshal(map[string]interface{}{
+			"db_config":    merge(file.DBConfig, stageFile.DBConfig),
+			"stage_config": merge(file.StageConfig, stageFile.StageConfig),
+		}, &testConfig)
+		if err != nil {
+			validations = append(validations, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		stageImpl, stageValidations := NewStage(testConfig)
+		for _, validation := range stageValidations {
+			validations = append(validations, fmt.Sprintf("%s: %s", name, validation))
+		}
+		stages = append(stages, stage.SuiteStage{Name: name, ID: stage.GenerateID(), Stage: stageImpl})
+	}
+	if len(validations) > 0 {
+		return nil, validations, nil
+	}
+	return stage.NewSuite(file.Name, stages), nil, nil
+}
+
+//decodeYAML decodes YAML, or JSON as it is a subset of it, into a struct with json tags
+func decodeYAML(content []byte, out interface{}) error {
+	var document interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return fmt.Errorf("parsing the file: %v", err)
+	}
+	return remarshal(jsonValue(document), out)
+}
+
+//remarshal decodes a generic value into a struct through its JSON encoding
+func remarshal(value interface{}, out interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, out)
+}
+
+//jsonValue turns the maps decoded by yaml, keyed by interface{}, into maps keyed by string
+func jsonValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[fmt.Sprint(key)] = jsonValue(item)
+		}
+		return result
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = jsonValue(item)
+		}
+	}
+	return value
+}
+
+//merge returns the defaults with the fields of overrides on top, nested objects are merged and lists replaced
+func merge(defaults map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(defaults)+len(overrides))
+	for key, value := range defaults {
+		result[key] = value
+	}
+	for key, value := range overrides {
+		defaultMap, defaultIsMap := result[key].(map[string]interface{})
+		overrideMap, overrideIsMap := value.(map[string]interface{})
+		if defaultIsMap && overrideIsMap {
+			result[key] = merge(defaultMap, overrideMap)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
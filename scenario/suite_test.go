@@ -0,0 +1,103 @@
+package scenario
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	defaults := map[string]interface{}{
+		"workers_count": 2,
+		"slos":          []interface{}{"p99_ms < 50"},
+		"search":        map[string]interface{}{"variable": "rate", "start": 100},
+	}
+	overrides := map[string]interface{}{
+		"workers_count": 4,
+		"slos":          []interface{}{"errors == 0"},
+		"search":        map[string]interface{}{"start": 200},
+	}
+
+	merged := merge(defaults, overrides)
+	want := map[string]interface{}{
+		"workers_count": 4,
+		"slos":          []interface{}{"errors == 0"},
+		"search":        map[string]interface{}{"variable": "rate", "start": 200},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("got %v, want %v", merged, want)
+	}
+	if defaults["workers_count"] != 2 || defaults["search"].(map[string]interface{})["start"] != 100 {
+		t.Errorf("the defaults changed: %v", defaults)
+	}
+	if merged := merge(nil, nil); len(merged) != 0 {
+		t.Errorf("nothing to merge: got %v", merged)
+	}
+}
+
+const suiteDefaults = `
+name: pools
+db_config:
+  db_name: test
+  collection_name: stores
+  conn_string: mongodb://localhost:27017
+  max_pool_size: 10
+  socket_timeout: 5
+stage_config:
+  workers_count: 2
+  producers_count: 1
+  msg_by_sec: 100
+  query_timeout_ms: 500
+  collection_size: 100
+  load_profile:
+    - duration_secs: 10
+`
+
+func TestNewSuite(t *testing.T) {
+	suite, validations, err := NewSuite([]byte(suiteDefaults + `
+stages:
+  - name: small pool
+  - name: big pool
+    db_config:
+      max_pool_size: 100
+`))
+	if err != nil || len(validations) > 0 {
+		t.Fatalf("got %v %v", validations, err)
+	}
+	stages := suite.Stages()
+	if len(stages) != 2 || stages[0].Name != "small pool" || stages[1].Name != "big pool" {
+		t.Fatalf("got %+v, want small pool and big pool", stages)
+	}
+	if stages[0].ID == stages[1].ID {
+		t.Error("the stages share their id")
+	}
+}
+
+func TestNewSuiteValidations(t *testing.T) {
+	tests := map[string]string{
+		"The suite has no stages": suiteDefaults,
+		"Stage name stage 1 is repeated": suiteDefaults + `
+stages:
+  - {}
+  - name: stage 1
+`,
+		"big pool: MaxPoolSize is required": suiteDefaults + `
+stages:
+  - name: big pool
+    db_config:
+      max_pool_size: 0
+`,
+	}
+	for text, content := range tests {
+		_, validations, err := NewSuite([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasValidation(validations, text) {
+			t.Errorf("got validations %v, want %q", validations, text)
+		}
+	}
+
+	if _, _, err := NewSuite([]byte("stages: [")); err == nil {
+		t.Error("invalid YAML: expected an error")
+	}
+}
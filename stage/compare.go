@@ -0,0 +1,290 @@
+package stage
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+//DefaultTolerance is the relative change, in percentage, a metric must go over to be a regression
+const DefaultTolerance = 10
+
+//zCritical is the two sided 95% critical value of the normal distribution
+const zCritical = 1.96
+
+//minTailSamples is the number of samples over a percentile needed to trust its change, with less the
+//percentile is close to the max, a single sample
+const minTailSamples = 10
+
+//Comparison diffs a candidate stage against a base one, in total and step by step
+type Comparison struct {
+	Base                string       `json:"base"`
+	Candidate           string       `json:"candidate"`
+	TolerancePercentage float64      `json:"tolerance_percentage"`
+	Regressed           bool         `json:"regressed"`
+	Regressions         []string     `json:"regressions"`
+	Total               []MetricDiff `json:"total"`
+	Steps               []StepDiff   `json:"steps"`
+	//StepsMismatch is set when the stages have a different number of steps, only the common ones are compared
+	StepsMismatch bool `json:"steps_mismatch,omitempty"`
+}
+
+//StepDiff diffs the steps with the same number of both stages
+type StepDiff struct {
+	Step    int          `json:"step"`
+	Name    string       `json:"name,omitempty"`
+	Phase   Phase        `json:"phase"`
+	Metrics []MetricDiff `json:"metrics"`
+}
+
+//MetricDiff is the change of a metric from the base to the candidate
+type MetricDiff struct {
+	Metric          string  `json:"metric"`
+	Base            float64 `json:"base"`
+	Candidate       float64 `json:"candidate"`
+	Delta           float64 `json:"delta"`
+	DeltaPercentage float64 `json:"delta_percentage"`
+	//Significant tells the change is not explained by chance: a z-test for the throughput and the error rates,
+	//non overlapping confidence intervals for the latency percentiles
+	Significant bool `json:"significant"`
+	Regression  bool `json:"regression"`
+}
+
+//comparedCounters are the values of a stage or a step used by the comparison
+type comparedCounters struct {
+	//queries are the completed queries the error rates are taken over
+	queries int64
+	//completed are the queries completed within duration, the throughput is taken over them
+	completed  int64
+	timeouts   int64
+	errors     int64
+	kinds      map[string]int64
+	duration   time.Duration
+	throughput float64
+	latency    stats.LatencySummary
+	pool       stats.PoolSnapshot
+}
+
+//Compare diffs the candidate against the base, a metric regresses when it gets worse by more than the tolerance
+//percentage and the change is significant
+func Compare(base *StageResult, candidate *StageResult, tolerance float64) Comparison {
+	comparison := Comparison{
+		Base:                base.ID,
+		Candidate:           candidate.ID,
+		TolerancePercentage: tolerance,
+		Regressions:         []string{},
+		Total:               compareCounters(totalCounters(base), totalCounters(candidate), tolerance),
+		StepsMismatch:       len(base.Steps) != len(candidate.Steps),
+	}
+	comparison.addRegressions("total", comparison.Total)
+
+	var previousBase, previousCandidate stats.PoolSnapshot
+	for i := 0; i < len(base.Steps) && i < len(candidate.Steps); i++ {
+		baseStep, candidateStep := base.Steps[i], candidate.Steps[i]
+		diff := StepDiff{
+			Step:  baseStep.Step,
+			Name:  candidateStep.Name,
+			Phase: candidateStep.Phase,
+			Metrics: compareCounters(
+				stepCounters(baseStep, previousBase),
+				stepCounters(candidateStep, previousCandidate),
+				tolerance),
+		}
+		comparison.Steps = append(comparison.Steps, diff)
+		comparison.addRegressions(fmt.Sprintf("step %d", diff.Step), diff.Metrics)
+		previousBase, previousCandidate = baseStep.PoolStats, candidateStep.PoolStats
+	}
+	comparison.Regressed = len(comparison.Regressions) > 0
+	return comparison
+}
+
+func (c *Comparison) addRegressions(scope string, metrics []MetricDiff) {
+	for _, metric := range metrics {
+		if metric.Regression {
+			c.Regressions = append(c.Regressions, fmt.Sprintf("%s %s: %.2f -> %.2f (%+.1f%%)",
+				scope, metric.Metric, metric.Base, metric.Candidate, metric.DeltaPercentage))
+		}
+	}
+}
+
+//totalCounters takes the rates of the stage over its completed queries and its throughput over the load steps,
+//like the steps, so the seeding time of each run does not change them
+func totalCounters(result *StageResult) comparedCounters {
+	loadQueries, loadTime := loadWindow(result.Steps)
+	return comparedCounters{
+		queries:    result.Completed,
+		completed:  loadQueries,
+		timeouts:   result.Timeouts,
+		errors:     result.ErrorCount,
+		kinds:      result.Errors,
+		duration:   loadTime,
+		throughput: throughput(loadQueries, loadTime),
+		latency:    result.Latency,
+		pool:       result.PoolStats,
+	}
+}
+
+//stepCounters takes the pool counters of the step out of the cumulative snapshots
+func stepCounters(step StepResult, previous stats.PoolSnapshot) comparedCounters {
+	pool := step.PoolStats
+	pool.Created -= previous.Created
+	pool.Closed -= previous.Closed
+	pool.Returned -= previous.Returned
+	pool.GetsOK -= previous.GetsOK
+	pool.GetsFailed -= previous.GetsFailed
+	pool.Clears -= previous.Clears
+	return comparedCounters{
+		queries:    step.Queries,
+		completed:  step.Queries,
+		timeouts:   step.Timeouts,
+		errors:     step.ErrorCount,
+		kinds:      step.Errors,
+		duration:   step.FinishedAt.Sub(step.StartedAt),
+		throughput: step.Throughput,
+		latency:    step.Latency,
+		pool:       pool,
+	}
+}
+
+func compareCounters(base comparedCounters, candidate comparedCounters, tolerance float64) []MetricDiff {
+	throughput := diff("throughput", base.throughput, candidate.throughput)
+	throughput.Significant = math.Abs(rateZ(base.completed, base.duration, candidate.completed, candidate.duration)) > zCritical
+	throughput.Regression = throughput.Significant && throughput.DeltaPercentage < -tolerance
+	metrics := []MetricDiff{throughput}
+
+	percentiles := []struct {
+		name      string
+		quantile  float64
+		base      float64
+		candidate float64
+	}{
+		{"p50_ms", 0.5, base.latency.P50Ms, candidate.latency.P50Ms},
+		{"p90_ms", 0.9, base.latency.P90Ms, candidate.latency.P90Ms},
+		{"p99_ms", 0.99, base.latency.P99Ms, candidate.latency.P99Ms},
+		{"p999_ms", 0.999, base.latency.P999Ms, candidate.latency.P999Ms},
+	}
+	for _, percentile := range percentiles {
+		metric := diff(percentile.name, percentile.base, percentile.candidate)
+		baseLow, baseHigh := quantileInterval(base.latency, percentile.quantile)
+		candidateLow, candidateHigh := quantileInterval(candidate.latency, percentile.quantile)
+		tail := math.Min(float64(base.latency.Count), float64(candidate.latency.Count)) * (1 - percentile.quantile)
+		metric.Significant = tail >= minTailSamples && (candidateLow > baseHigh || candidateHigh < baseLow)
+		metric.Regression = metric.Significant && metric.DeltaPercentage > tolerance
+		metrics = append(metrics, metric)
+	}
+	//the max is a single sample, it is reported but never flagged
+	metrics = append(metrics, diff("max_ms", base.latency.MaxMs, candidate.latency.MaxMs))
+
+	metrics = append(metrics,
+		rateDiff("error_rate", base.errors, base.queries, candidate.errors, candidate.queries),
+		rateDiff("timeout_rate", base.timeouts, base.queries, candidate.timeouts, candidate.queries))
+	for _, kind := range errorKinds(base.kinds, candidate.kinds) {
+		metrics = append(metrics, rateDiff("error_rate."+kind, base.kinds[kind], base.queries, candidate.kinds[kind], candidate.queries))
+	}
+
+	//the pool counters are reported, only more failed checkouts are flagged
+	metrics = append(metrics,
+		diff("pool.created", float64(base.pool.Created), float64(candidate.pool.Created)),
+		diff("pool.closed", float64(base.pool.Closed), float64(candidate.pool.Closed)),
+		diff("pool.in_use", float64(base.pool.InUse), float64(candidate.pool.InUse)),
+		diff("pool.gets_ok", float64(base.pool.GetsOK), float64(candidate.pool.GetsOK)),
+		diff("pool.peak_in_use", float64(base.pool.PeakInUse), float64(candidate.pool.PeakInUse)),
+		diff("pool.clears", float64(base.pool.Clears), float64(candidate.pool.Clears)),
+		rateDiff("pool.gets_failed_rate", base.pool.GetsFailed, base.pool.GetsOK+base.pool.GetsFailed,
+			candidate.pool.GetsFailed, candidate.pool.GetsOK+candidate.pool.GetsFailed))
+	return metrics
+}
+
+func diff(metric string, base float64, candidate float64) MetricDiff {
+	result := MetricDiff{
+		Metric:    metric,
+		Base:      base,
+		Candidate: candidate,
+		Delta:     candidate - base,
+	}
+	if base != 0 {
+		result.DeltaPercentage = math.Round(10000*(candidate-base)/base) / 100
+	}
+	return result
+}
+
+//rateDiff compares the percentage of count over total, a higher rate is a regression when a two
+//proportion z-test finds it significant
+func rateDiff(metric string, baseCount int64, baseTotal int64, candidateCount int64, candidateTotal int64) MetricDiff {
+	result := diff(metric, percentage(baseCount, baseTotal), percentage(candidateCount, candidateTotal))
+	result.Significant = math.Abs(proportionZ(baseCount, baseTotal, candidateCount, candidateTotal)) > zCritical
+	result.Regression = result.Significant && result.Delta > 0
+	return result
+}
+
+//rateZ is the z statistic of the difference between two Poisson rates, positive when the candidate is faster
+func rateZ(baseCount int64, baseDuration time.Duration, candidateCount int64, candidateDuration time.Duration) float64 {
+	baseSecs, candidateSecs := baseDuration.Seconds(), candidateDuration.Seconds()
+	if baseSecs <= 0 || candidateSecs <= 0 || baseCount+candidateCount == 0 {
+		return 0
+	}
+	variance := float64(baseCount)/(baseSecs*baseSecs) + float64(candidateCount)/(candidateSecs*candidateSecs)
+	return (float64(candidateCount)/candidateSecs - float64(baseCount)/baseSecs) / math.Sqrt(variance)
+}
+
+//proportionZ is the z statistic of the difference between two proportions, positive when the candidate is higher
+func proportionZ(baseCount int64, baseTotal int64, candidateCount int64, candidateTotal int64) float64 {
+	if baseTotal == 0 || candidateTotal == 0 {
+		return 0
+	}
+	pooled := float64(baseCount+candidateCount) / float64(baseTotal+candidateTotal)
+	standardError := math.Sqrt(pooled * (1 - pooled) * (1/float64(baseTotal) + 1/float64(candidateTotal)))
+	if standardError == 0 {
+		return 0
+	}
+	return (float64(candidateCount)/float64(candidateTotal) - float64(baseCount)/float64(baseTotal)) / standardError
+}
+
+//quantileInterval is the 95% confidence interval of a quantile: the ranks of the interval of a binomial
+//proportion, turned into latencies by interpolating between the percentiles of the summary
+func quantileInterval(summary stats.LatencySummary, quantile float64) (float64, float64) {
+	if summary.Count == 0 {
+		return 0, 0
+	}
+	margin := zCritical * math.Sqrt(quantile*(1-quantile)/float64(summary.Count))
+	return quantileAt(summary, quantile-margin), quantileAt(summary, quantile+margin)
+}
+
+//quantileAt interpolates the latency at the quantile between the percentiles of the summary
+func quantileAt(summary stats.LatencySummary, quantile float64) float64 {
+	points := []struct {
+		quantile float64
+		value    float64
+	}{
+		{0, summary.MinMs}, {0.5, summary.P50Ms}, {0.9, summary.P90Ms}, {0.99, summary.P99Ms}, {0.999, summary.P999Ms}, {1, summary.MaxMs},
+	}
+	if quantile <= 0 {
+		return summary.MinMs
+	}
+	for i := 1; i < len(points); i++ {
+		if quantile <= points[i].quantile {
+			low, high := points[i-1], points[i]
+			return low.value + (high.value-low.value)*(quantile-low.quantile)/(high.quantile-low.quantile)
+		}
+	}
+	return summary.MaxMs
+}
+
+func errorKinds(base map[string]int64, candidate map[string]int64) []string {
+	kinds := make(map[string]bool)
+	for kind := range base {
+		kinds[kind] = true
+	}
+	for kind := range candidate {
+		kinds[kind] = true
+	}
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	return names
+}
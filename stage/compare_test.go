@@ -0,0 +1,145 @@
+package stage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+func TestRateZ(t *testing.T) {
+	if z := rateZ(1000, 10*time.Second, 1000, 10*time.Second); z != 0 {
+		t.Errorf("same rate: got %v, want 0", z)
+	}
+	//100/s against 120/s over 10s: (120-100)/sqrt(1000/100+1200/100)
+	want := 20 / math.Sqrt(22)
+	if z := rateZ(1000, 10*time.Second, 1200, 10*time.Second); math.Abs(z-want) > 1e-9 {
+		t.Errorf("faster candidate: got %v, want %v", z, want)
+	}
+	if z := rateZ(1200, 10*time.Second, 1000, 10*time.Second); z >= 0 {
+		t.Errorf("slower candidate: got %v, want a negative z", z)
+	}
+	if z := rateZ(10, 0, 10, time.Second); z != 0 {
+		t.Errorf("no duration: got %v, want 0", z)
+	}
+}
+
+func TestProportionZ(t *testing.T) {
+	if z := proportionZ(10, 1000, 10, 1000); z != 0 {
+		t.Errorf("same proportion: got %v, want 0", z)
+	}
+	if z := proportionZ(10, 1000, 50, 1000); z <= zCritical {
+		t.Errorf("1%% against 5%%: got %v, want over %v", z, zCritical)
+	}
+	if z := proportionZ(10, 1000, 12, 1000); math.Abs(z) > zCritical {
+		t.Errorf("1%% against 1.2%%: got %v, want not significant", z)
+	}
+	if z := proportionZ(0, 1000, 0, 1000); z != 0 {
+		t.Errorf("no errors: got %v, want 0", z)
+	}
+	if z := proportionZ(1, 0, 1, 10); z != 0 {
+		t.Errorf("no queries: got %v, want 0", z)
+	}
+}
+
+func TestQuantileAt(t *testing.T) {
+	summary := stats.LatencySummary{Count: 1000, MinMs: 1, P50Ms: 10, P90Ms: 20, P99Ms: 50, P999Ms: 80, MaxMs: 100}
+	tests := []struct {
+		quantile float64
+		want     float64
+	}{
+		{-0.1, 1},
+		{0, 1},
+		{0.25, 5.5},
+		{0.5, 10},
+		{0.7, 15},
+		{0.99, 50},
+		{1, 100},
+		{1.5, 100},
+	}
+	for _, test := range tests {
+		if got := quantileAt(summary, test.quantile); math.Abs(got-test.want) > 1e-9 {
+			t.Errorf("quantile %v: got %v, want %v", test.quantile, got, test.want)
+		}
+	}
+
+	low, high := quantileInterval(summary, 0.5)
+	if low >= 10 || high <= 10 {
+		t.Errorf("interval of p50: got [%v, %v], want around 10", low, high)
+	}
+}
+
+func comparedResult(id string, seeding time.Duration, queries int64, errors int64, p99 float64) *StageResult {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	loadStart := start.Add(seeding)
+	latency := stats.LatencySummary{Count: queries, MinMs: 1, P50Ms: 5, P90Ms: 10, P99Ms: p99, P999Ms: p99 + 5, MaxMs: p99 + 10}
+	step := StepResult{
+		Step:       1,
+		Phase:      PhaseHolding,
+		StartedAt:  loadStart,
+		FinishedAt: loadStart.Add(60 * time.Second),
+		Queries:    queries,
+		ErrorCount: errors,
+		Throughput: float64(queries) / 60,
+		Latency:    latency,
+	}
+	return &StageResult{
+		ID:         id,
+		StartedAt:  start,
+		FinishedAt: step.FinishedAt.Add(time.Second),
+		QueryCount: queries,
+		Completed:  queries,
+		ErrorCount: errors,
+		Throughput: float64(queries) / 60,
+		Latency:    latency,
+		Steps:      []StepResult{step},
+	}
+}
+
+func TestCompareIgnoresSeedingTime(t *testing.T) {
+	//the same load after a fresh seeding and against an existing collection
+	base := comparedResult("base", 2*time.Minute, 60000, 60, 20)
+	candidate := comparedResult("candidate", 0, 60000, 60, 20)
+
+	comparison := Compare(base, candidate, DefaultTolerance)
+	if comparison.Regressed {
+		t.Errorf("got regressions %v, want none", comparison.Regressions)
+	}
+	if throughput := comparison.Total[0]; throughput.Significant {
+		t.Errorf("throughput: got a significant change %+v", throughput)
+	}
+}
+
+func TestCompareRegressions(t *testing.T) {
+	base := comparedResult("base", 0, 60000, 60, 20)
+	candidate := comparedResult("candidate", 0, 30000, 600, 40)
+
+	comparison := Compare(base, candidate, DefaultTolerance)
+	regressed := make(map[string]bool)
+	for _, metric := range comparison.Total {
+		if metric.Regression {
+			regressed[metric.Metric] = true
+		}
+	}
+	for _, metric := range []string{"throughput", "p99_ms", "error_rate"} {
+		if !regressed[metric] {
+			t.Errorf("%s: expected a regression, got %v", metric, comparison.Regressions)
+		}
+	}
+	if len(comparison.Steps) != 1 {
+		t.Fatalf("got %d steps, want 1", len(comparison.Steps))
+	}
+}
+
+func TestCompareTotalAndStepsShareTheRateBasis(t *testing.T) {
+	base := comparedResult("base", time.Minute, 60000, 60, 20)
+	candidate := comparedResult("candidate", 0, 54000, 60, 20)
+
+	comparison := Compare(base, candidate, DefaultTolerance)
+	total, step := comparison.Total[0], comparison.Steps[0].Metrics[0]
+	if total.Base != step.Base || total.Candidate != step.Candidate {
+		t.Errorf("single step stage: total throughput %v -> %v, step %v -> %v",
+			total.Base, total.Candidate, step.Base, step.Candidate)
+	}
+}
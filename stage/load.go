@@ -0,0 +1,290 @@
+package stage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//errLoadStopped is returned when the load is changed after its producers were stopped
+var errLoadStopped = errors.New("load is stopped")
+
+//load owns the producers and the workers of a running stage, the workers and the rate can be changed while it runs
+type load struct {
+	ctx           context.Context
+	eventChannel  chan request
+	open          bool
+	workload      *Workload
+	params        OperationParams
+	lateThreshold time.Duration
+	recorder      *recorder
+	producers     []*producer
+	workers       []*consumer
+	rate          float64
+	wgP           *sync.WaitGroup
+	wgW           *sync.WaitGroup
+	//stopped is set once the producers are stopped, the load can not be changed anymore
+	stopped bool
+	mutex   sync.Mutex
+}
+
+func newLoad(ctx context.Context, config Config, workload *Workload, recorder *recorder) *load {
+	lateThreshold := defaultLateThreshold
+	if config.LateThresholdMs != 0 {
+		lateThreshold = time.Duration(config.LateThresholdMs) * time.Millisecond
+	}
+	return &load{
+		ctx:          ctx,
+		eventChannel: make(chan request, 1000),
+		open:         config.LoadModel == LoadModelOpen,
+		workload:     workload,
+		params: OperationParams{
+			TimeoutMs:    config.QueryTimeoutMs,
+			BatchSize:    config.BatchSize,
+			DocumentSize: config.DocumentSize,
+		},
+		lateThreshold: lateThreshold,
+		recorder:      recorder,
+		wgP:           &sync.WaitGroup{},
+		wgW:           &sync.WaitGroup{},
+	}
+}
+
+//start launches the producers sending rate requests by second between them and the workers
+func (l *load) start(producersCount int, workersCount int, rate float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.rate = rate
+	l.addProducers(producersCount)
+	l.addWorkers(workersCount)
+}
+
+//setProducers adds or stops producers until count are running, the rate is split between them
+func (l *load) setProducers(count int) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.stopped {
+		return errLoadStopped
+	}
+	if count > len(l.producers) {
+		l.addProducers(count - len(l.producers))
+		return nil
+	}
+	for len(l.producers) > count {
+		last := len(l.producers) - 1
+		l.producers[last].stop()
+		l.producers = l.producers[:last]
+	}
+	l.updateIntervals()
+	return nil
+}
+
+func (l *load) addProducers(count int) {
+	total := len(l.producers) + count
+	interval := producerInterval(total, l.rate)
+	begin := time.Now()
+
+	l.wgP.Add(count)
+	for i := 0; i < count; i++ {
+		producer := &producer{
+			eventChannel: l.eventChannel,
+			recorder:     l.recorder,
+			wg:           l.wgP,
+			done:         make(chan struct{}),
+			interval:     int64(interval),
+		}
+		l.producers = append(l.producers, producer)
+
+		if l.open {
+			//each producer is offset so the requests are evenly spaced
+			go producer.startOpen(l.ctx, begin.Add(time.Duration(i)*interval/time.Duration(count)))
+		} else {
+			go producer.start(l.ctx)
+		}
+	}
+	l.updateIntervals()
+}
+
+func (l *load) updateIntervals() {
+	interval := producerInterval(len(l.producers), l.rate)
+	for _, producer := range l.producers {
+		producer.setInterval(interval)
+	}
+}
+
+//setWorkers adds or stops workers until count are running, the stopped ones finish their current request first
+func (l *load) setWorkers(count int) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.stopped {
+		return errLoadStopped
+	}
+	if count > len(l.workers) {
+		l.addWorkers(count - len(l.workers))
+		return nil
+	}
+	for len(l.workers) > count {
+		last := len(l.workers) - 1
+		l.workers[last].stop()
+		l.workers = l.workers[:last]
+	}
+	return nil
+}
+
+func (l *load) addWorkers(count int) {
+	l.wgW.Add(count)
+	for i := 0; i < count; i++ {
+		consumer := &consumer{
+			eventChannel:  l.eventChannel,
+			workload:      l.workload,
+			params:        l.params,
+			lateThreshold: l.lateThreshold,
+			recorder:      l.recorder,
+			wg:            l.wgW,
+			done:          make(chan struct{}),
+		}
+		l.workers = append(l.workers, consumer)
+		go consumer.start(l.ctx)
+	}
+}
+
+//setRate changes the requests by second sent by the producers
+func (l *load) setRate(rate float64) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.stopped {
+		return errLoadStopped
+	}
+	if rate <= 0 {
+		return nil
+	}
+	l.rate = rate
+	l.updateIntervals()
+	return nil
+}
+
+//counts returns the running workers and producers and the current rate
+func (l *load) counts() (int, int, float64) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return len(l.workers), len(l.producers), l.rate
+}
+
+//stopProducers stops sending requests, the queued ones are still executed. The load can not be changed afterwards
+func (l *load) stopProducers() {
+	l.mutex.Lock()
+	l.stopped = true
+	for _, producer := range l.producers {
+		producer.stop()
+	}
+	l.producers = nil
+	l.mutex.Unlock()
+
+	l.wgP.Wait()
+}
+
+//queued returns the requests waiting for a worker
+func (l *load) queued() int {
+	return len(l.eventChannel)
+}
+
+//stop closes the channel and waits for the workers, it must be called after stopProducers
+func (l *load) stop() {
+	close(l.eventChannel)
+	l.wgW.Wait()
+
+	l.mutex.Lock()
+	l.workers = nil
+	l.mutex.Unlock()
+}
+
+func producerInterval(producersCount int, rate float64) time.Duration {
+	return time.Duration(float64(producersCount) * float64(time.Second) / rate)
+}
+
+type producer struct {
+	eventChannel chan<- request
+	recorder     *recorder
+	wg           *sync.WaitGroup
+	done         chan struct{}
+	interval     int64
+}
+
+func (p *producer) start(ctx context.Context) {
+	defer p.wg.Done()
+
+	interval := p.currentInterval()
+	tm := time.NewTicker(interval)
+	defer tm.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.done:
+			return
+		case <-tm.C:
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.done:
+			return
+		case p.eventChannel <- request{}:
+		}
+
+		if current := p.currentInterval(); current != interval {
+			interval = current
+			tm.Reset(interval)
+		}
+	}
+}
+
+//startOpen sends a request every interval starting at next, it never blocks: when the workers fall behind
+//the requests are sent late, with their intended start, and the ones that do not fit in the channel are dropped
+func (p *producer) startOpen(ctx context.Context, next time.Time) {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.done:
+			return
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		for !next.After(now) {
+			select {
+			case p.eventChannel <- request{intended: next}:
+			default:
+				p.recorder.drop()
+			}
+			next = next.Add(p.currentInterval())
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+func (p *producer) currentInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&p.interval))
+}
+
+func (p *producer) setInterval(interval time.Duration) {
+	atomic.StoreInt64(&p.interval, int64(interval))
+}
+
+func (p *producer) stop() {
+	close(p.done)
+}
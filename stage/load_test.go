@@ -0,0 +1,75 @@
+package stage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+func stoppedLoad(t *testing.T) *load {
+	t.Helper()
+	l := newLoad(context.Background(), Config{}, nil, newRecorder())
+	l.start(1, 0, 10)
+	l.stopProducers()
+	l.stop()
+	return l
+}
+
+func TestLoadChangesAfterStop(t *testing.T) {
+	l := stoppedLoad(t)
+
+	if err := l.setProducers(2); err != errLoadStopped {
+		t.Errorf("setProducers after stop: got %v, want %v", err, errLoadStopped)
+	}
+	if err := l.setWorkers(2); err != errLoadStopped {
+		t.Errorf("setWorkers after stop: got %v, want %v", err, errLoadStopped)
+	}
+	if err := l.setRate(20); err != errLoadStopped {
+		t.Errorf("setRate after stop: got %v, want %v", err, errLoadStopped)
+	}
+	if workers, producers, _ := l.counts(); workers != 0 || producers != 0 {
+		t.Errorf("counts after stop: got %d workers and %d producers, want none", workers, producers)
+	}
+}
+
+func TestLoadScale(t *testing.T) {
+	l := newLoad(context.Background(), Config{}, nil, newRecorder())
+	l.start(1, 0, 10)
+
+	if err := l.setProducers(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.setRate(30); err != nil {
+		t.Fatal(err)
+	}
+	if _, producers, rate := l.counts(); producers != 3 || rate != 30 {
+		t.Errorf("got %d producers at %.0f/s, want 3 at 30/s", producers, rate)
+	}
+	if err := l.setProducers(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, producers, _ := l.counts(); producers != 1 {
+		t.Errorf("got %d producers, want 1", producers)
+	}
+
+	l.stopProducers()
+	l.stop()
+}
+
+func TestStageScaleAfterStop(t *testing.T) {
+	s := New(repositories.MongoDBConfiguration{}, Config{})
+	s.setLoad(stoppedLoad(t))
+
+	if err := s.Scale(2, 2, 20); err != ErrNotRunning {
+		t.Errorf("Scale after stop: got %v, want %v", err, ErrNotRunning)
+	}
+}
+
+func TestStageScaleNotStarted(t *testing.T) {
+	s := New(repositories.MongoDBConfiguration{}, Config{})
+
+	if err := s.Scale(2, 0, 0); err != ErrNotRunning {
+		t.Errorf("Scale before start: got %v, want %v", err, ErrNotRunning)
+	}
+}
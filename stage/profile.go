@@ -0,0 +1,122 @@
+package stage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+//Shapes of the load profile phases
+const (
+	//ShapeStep reaches the workers and the rate of the phase at its start and holds them
+	ShapeStep = "step"
+	//ShapeRamp moves linearly from the workers and the rate of the previous phase to the ones of the phase
+	ShapeRamp = "ramp"
+)
+
+//ProfilePhase is a phase of the load profile, zero workers or rate keeps the value of the previous phase
+type ProfilePhase struct {
+	Name         string `json:"name,omitempty"`
+	Shape        string `json:"shape,omitempty"`
+	DurationSecs uint   `json:"duration_secs"`
+	Workers      uint   `json:"workers,omitempty"`
+	Rate         uint   `json:"rate,omitempty"`
+	phase        Phase
+}
+
+//ValidateProfile checks the phases of a load profile
+func ValidateProfile(profile []ProfilePhase) error {
+	for i, phase := range profile {
+		if phase.Shape != "" && phase.Shape != ShapeStep && phase.Shape != ShapeRamp {
+			return fmt.Errorf("phase %d: shape must be %s or %s", i+1, ShapeStep, ShapeRamp)
+		}
+		if phase.DurationSecs == 0 {
+			return fmt.Errorf("phase %d: duration_secs is required", i+1)
+		}
+	}
+	return nil
+}
+
+//profile returns the load profile of the config, without one the workers_to_add every time_to_sleep_secs
+//for increment_load steps are translated into phases
+func (c Config) profile() []ProfilePhase {
+	if len(c.LoadProfile) > 0 {
+		profile := make([]ProfilePhase, len(c.LoadProfile))
+		for i, phase := range c.LoadProfile {
+			phase.phase = PhaseHolding
+			if phase.Shape == ShapeRamp {
+				phase.phase = PhaseRamping
+			}
+			profile[i] = phase
+		}
+		return profile
+	}
+
+	var profile []ProfilePhase
+	for n := uint(0); n < c.IncrementLoad; n++ {
+		profile = append(profile, ProfilePhase{
+			Shape:        ShapeStep,
+			DurationSecs: c.TimeToSleepSecs,
+			Workers:      c.WorkersCount + n*c.WorkersToAdd,
+			phase:        PhaseRamping,
+		})
+	}
+	return append(profile, ProfilePhase{
+		Shape:        ShapeStep,
+		DurationSecs: c.TimeToFinishSecs,
+		Workers:      c.WorkersCount + c.IncrementLoad*c.WorkersToAdd,
+		phase:        PhaseHolding,
+	})
+}
+
+//initialRate returns the requests by second sent when the stage starts, by default the nominal rate of the producers
+func (c Config) initialRate() float64 {
+	if c.LoadModel == LoadModelOpen && c.TargetRate != 0 {
+		return float64(c.TargetRate)
+	}
+	return float64(c.ProducersCount * c.MsgBySec)
+}
+
+func (s *Stage) runProfile(ctx context.Context, repo repositories.TestRepository, load *load, profile []ProfilePhase) {
+	for i, phase := range profile {
+		if ctx.Err() != nil {
+			return
+		}
+
+		fromWorkers, producers, fromRate := load.counts()
+		toWorkers, toRate := fromWorkers, fromRate
+		if phase.Workers != 0 {
+			toWorkers = int(phase.Workers)
+		}
+		if phase.Rate != 0 {
+			toRate = float64(phase.Rate)
+		}
+		if phase.Shape != ShapeRamp {
+			load.setWorkers(toWorkers)
+			load.setRate(toRate)
+			s.setCounts(toWorkers, producers)
+		}
+
+		s.startStep(phase.phase, i+1, phase.Name, toWorkers, producers)
+		logrus.Printf("Step %d of %d %s: %d workers and %.0f requests by second for %d seconds",
+			i+1, len(profile), phase.Name, toWorkers, toRate, phase.DurationSecs)
+
+		duration := int(phase.DurationSecs)
+		for second := 1; second <= duration && ctx.Err() == nil; second++ {
+			logrus.WithField("executed", repo.QueryCount()).Infof("%v", s.poolStats)
+			sleep(ctx, 1*time.Second)
+
+			if phase.Shape == ShapeRamp {
+				progress := float64(second) / float64(duration)
+				workers := fromWorkers + int(float64(toWorkers-fromWorkers)*progress)
+				load.setWorkers(workers)
+				load.setRate(fromRate + (toRate-fromRate)*progress)
+				s.setCounts(workers, producers)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package stage
+
+import "testing"
+
+func TestLegacyConfigProfile(t *testing.T) {
+	config := Config{WorkersCount: 2, WorkersToAdd: 3, IncrementLoad: 2, TimeToSleepSecs: 10, TimeToFinishSecs: 30}
+
+	profile := config.profile()
+	want := []ProfilePhase{
+		{Shape: ShapeStep, DurationSecs: 10, Workers: 2, phase: PhaseRamping},
+		{Shape: ShapeStep, DurationSecs: 10, Workers: 5, phase: PhaseRamping},
+		{Shape: ShapeStep, DurationSecs: 30, Workers: 8, phase: PhaseHolding},
+	}
+	if len(profile) != len(want) {
+		t.Fatalf("got %d phases, want %d", len(profile), len(want))
+	}
+	for i := range want {
+		if profile[i] != want[i] {
+			t.Errorf("phase %d: got %+v, want %+v", i+1, profile[i], want[i])
+		}
+	}
+}
+
+func TestLoadProfilePhases(t *testing.T) {
+	config := Config{
+		WorkersCount: 2,
+		LoadProfile: []ProfilePhase{
+			{Name: "warm up", Shape: ShapeRamp, DurationSecs: 10, Workers: 10},
+			{Name: "hold", DurationSecs: 60},
+		},
+	}
+
+	profile := config.profile()
+	if profile[0].phase != PhaseRamping || profile[1].phase != PhaseHolding {
+		t.Errorf("got phases %s and %s, want ramping and holding", profile[0].phase, profile[1].phase)
+	}
+	if profile[1].Name != "hold" || profile[1].DurationSecs != 60 {
+		t.Errorf("got %+v, want the hold phase", profile[1])
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	if err := ValidateProfile([]ProfilePhase{{Shape: ShapeRamp, DurationSecs: 1}, {DurationSecs: 1}}); err != nil {
+		t.Errorf("valid profile: %v", err)
+	}
+	if err := ValidateProfile([]ProfilePhase{{Shape: "sine", DurationSecs: 1}}); err == nil {
+		t.Error("unknown shape: expected an error")
+	}
+	if err := ValidateProfile([]ProfilePhase{{Shape: ShapeStep}}); err == nil {
+		t.Error("no duration: expected an error")
+	}
+}
+
+func TestConfigSteps(t *testing.T) {
+	profile := Config{LoadProfile: []ProfilePhase{{DurationSecs: 1}, {DurationSecs: 1}, {DurationSecs: 1}}}
+	if steps := profile.steps(); steps != 4 {
+		t.Errorf("load profile: got %d steps, want 3 phases and the draining", steps)
+	}
+
+	search := Config{Search: &SearchConfig{Start: 10, Step: 10, Max: 50, PoolSizes: []uint{5, 10}}}
+	if steps := search.steps(); steps != 12 {
+		t.Errorf("search: got %d steps, want 5 points and the draining by pool size", steps)
+	}
+}
@@ -0,0 +1,227 @@
+package stage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+type counters struct {
+	queries    int64
+	errors     int64
+	timeouts   int64
+	dropped    int64
+	late       int64
+	kinds      map[string]int64
+	latency    *stats.Histogram
+	queueWait  *stats.Histogram
+	operations map[string]*operationCounters
+}
+
+//outcome of a single query
+type outcome struct {
+	operation string
+	//executionTime is the time spent in the repository, in milliseconds
+	executionTime float64
+	//queueWait is the time between the intended start of the query and its actual start, zero in the closed loop mode
+	queueWait time.Duration
+	late      bool
+	category  string
+}
+
+//latency is the execution time plus the queue wait, in milliseconds
+func (o outcome) latency() float64 {
+	return o.executionTime + float64(o.queueWait)/float64(time.Millisecond)
+}
+
+type operationCounters struct {
+	queries int64
+	errors  int64
+	latency *stats.Histogram
+}
+
+//OperationResult holds the counters of a single operation of the workload
+type OperationResult struct {
+	Queries int64                `json:"queries"`
+	Errors  int64                `json:"errors"`
+	Latency stats.LatencySummary `json:"latency"`
+}
+
+func newCounters() *counters {
+	return &counters{
+		kinds:      make(map[string]int64),
+		latency:    stats.NewHistogram(),
+		queueWait:  stats.NewHistogram(),
+		operations: make(map[string]*operationCounters),
+	}
+}
+
+func (c *counters) add(result outcome) {
+	c.queries++
+	c.latency.RecordMs(result.latency())
+	c.queueWait.Record(result.queueWait)
+	if result.late {
+		c.late++
+	}
+
+	byOperation, ok := c.operations[result.operation]
+	if !ok {
+		byOperation = &operationCounters{latency: stats.NewHistogram()}
+		c.operations[result.operation] = byOperation
+	}
+	byOperation.queries++
+	byOperation.latency.RecordMs(result.latency())
+
+	if category := result.category; category != "" {
+		c.errors++
+		byOperation.errors++
+		c.kinds[category]++
+		if repositories.IsTimeoutCategory(category) {
+			c.timeouts++
+		}
+	}
+}
+
+func (c *counters) copyOperations() map[string]*operationCounters {
+	operations := make(map[string]*operationCounters, len(c.operations))
+	for name, byOperation := range c.operations {
+		operations[name] = &operationCounters{
+			queries: byOperation.queries,
+			errors:  byOperation.errors,
+			latency: byOperation.latency.Copy(),
+		}
+	}
+	return operations
+}
+
+func (c *counters) operationResults() map[string]OperationResult {
+	results := make(map[string]OperationResult, len(c.operations))
+	for name, byOperation := range c.operations {
+		results[name] = OperationResult{
+			Queries: byOperation.queries,
+			Errors:  byOperation.errors,
+			Latency: byOperation.latency.Summary(),
+		}
+	}
+	return results
+}
+
+func (c *counters) errorKinds() map[string]int64 {
+	kinds := make(map[string]int64, len(c.kinds))
+	for kind, count := range c.kinds {
+		kinds[kind] = count
+	}
+	return kinds
+}
+
+//recorder accumulates the outcome of every query, for the whole stage and for the current step
+type recorder struct {
+	total   *counters
+	current *counters
+	//interval is the latency of the queries completed since the last sample of the time series
+	interval *stats.Histogram
+	mutex    sync.Mutex
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		total:    newCounters(),
+		current:  newCounters(),
+		interval: stats.NewHistogram(),
+	}
+}
+
+//record adds the outcome of a query, category is empty when it succeeded
+func (r *recorder) record(result outcome) {
+	r.mutex.Lock()
+	r.total.add(result)
+	r.current.add(result)
+	r.interval.RecordMs(result.latency())
+	r.mutex.Unlock()
+}
+
+//drop counts a request the open loop producers could not queue
+func (r *recorder) drop() {
+	r.mutex.Lock()
+	r.total.dropped++
+	r.current.dropped++
+	r.mutex.Unlock()
+}
+
+//dropped returns the dropped and late requests of the stage
+func (r *recorder) dropped() (int64, int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total.dropped, r.total.late
+}
+
+//rotate returns the counters of the current step and starts a new one
+func (r *recorder) rotate() *counters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	current := r.current
+	r.current = newCounters()
+	return current
+}
+
+func (r *recorder) timeouts() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total.timeouts
+}
+
+func (r *recorder) errors() (int64, map[string]int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total.errors, r.total.errorKinds()
+}
+
+func (r *recorder) completed() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total.queries
+}
+
+func (r *recorder) latency() *stats.Histogram {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total.latency.Copy()
+}
+
+//sample returns the stage totals, without histograms, and the latency since the previous sample
+func (r *recorder) sample() (counters, stats.LatencySummary) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	interval := r.interval.Summary()
+	r.interval = stats.NewHistogram()
+	return counters{
+		queries:  r.total.queries,
+		errors:   r.total.errors,
+		timeouts: r.total.timeouts,
+		dropped:  r.total.dropped,
+		late:     r.total.late,
+		kinds:    r.total.errorKinds(),
+	}, interval
+}
+
+//snapshot returns a copy of the stage totals
+func (r *recorder) snapshot() counters {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return counters{
+		queries:    r.total.queries,
+		errors:     r.total.errors,
+		timeouts:   r.total.timeouts,
+		dropped:    r.total.dropped,
+		late:       r.total.late,
+		kinds:      r.total.errorKinds(),
+		latency:    r.total.latency.Copy(),
+		queueWait:  r.total.queueWait.Copy(),
+		operations: r.total.copyOperations(),
+	}
+}
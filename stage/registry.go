@@ -0,0 +1,84 @@
+package stage
+
+import (
+	"sync"
+	"time"
+)
+
+//Registry keeps track of the stages started by the server
+type Registry struct {
+	stages map[string]*Stage
+	ids    []string
+	mutex  sync.RWMutex
+}
+
+//NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		stages: make(map[string]*Stage),
+	}
+}
+
+//Add registers a stage under the given id
+func (r *Registry) Add(id string, stage *Stage) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.stages[id]; !ok {
+		r.ids = append(r.ids, id)
+	}
+	stage.setID(id)
+	r.stages[id] = stage
+}
+
+//Get returns the stage registered under the given id
+func (r *Registry) Get(id string) (*Stage, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stage, ok := r.stages[id]
+	return stage, ok
+}
+
+//List returns the status of every registered stage, in creation order
+func (r *Registry) List() []Status {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]Status, 0, len(r.ids))
+	for _, id := range r.ids {
+		result = append(result, r.stages[id].Status())
+	}
+	return result
+}
+
+//Prune removes the stages that are done since before the given time and returns their ids
+func (r *Registry) Prune(doneBefore time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var pruned []string
+	ids := r.ids[:0]
+	for _, id := range r.ids {
+		if r.stages[id].doneBefore(doneBefore) {
+			delete(r.stages, id)
+			pruned = append(pruned, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	r.ids = ids
+	return pruned
+}
+
+//All returns every registered stage, in creation order
+func (r *Registry) All() []*Stage {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]*Stage, 0, len(r.ids))
+	for _, id := range r.ids {
+		result = append(result, r.stages[id])
+	}
+	return result
+}
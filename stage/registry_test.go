@@ -0,0 +1,53 @@
+package stage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+func TestRegistryPrune(t *testing.T) {
+	registry := NewRegistry()
+	done := New(repositories.MongoDBConfiguration{}, Config{})
+	pending := New(repositories.MongoDBConfiguration{}, Config{})
+	registry.Add("done", done)
+	registry.Add("pending", pending)
+	done.skip("done")
+
+	if pruned := registry.Prune(time.Now().Add(-time.Hour)); len(pruned) != 0 {
+		t.Errorf("within the retention: got %v pruned, want none", pruned)
+	}
+
+	pruned := registry.Prune(time.Now().Add(time.Second))
+	if len(pruned) != 1 || pruned[0] != "done" {
+		t.Errorf("got %v pruned, want [done]", pruned)
+	}
+	if _, ok := registry.Get("done"); ok {
+		t.Error("the done stage is still registered")
+	}
+	if statuses := registry.List(); len(statuses) != 1 || statuses[0].ID != "pending" {
+		t.Errorf("got %v, want only the pending stage", statuses)
+	}
+}
+
+func TestSuiteRegistryPrune(t *testing.T) {
+	registry := NewSuiteRegistry()
+	done := NewSuite("done", nil)
+	registry.Add("done", done)
+	registry.Add("pending", NewSuite("pending", nil))
+	done.Run(context.Background(), "done", nil)
+
+	if pruned := registry.Prune(time.Now().Add(-time.Hour)); len(pruned) != 0 {
+		t.Errorf("within the retention: got %v pruned, want none", pruned)
+	}
+
+	pruned := registry.Prune(time.Now().Add(time.Second))
+	if len(pruned) != 1 || pruned[0] != "done" {
+		t.Errorf("got %v pruned, want [done]", pruned)
+	}
+	if reports := registry.List(); len(reports) != 1 || reports[0].ID != "pending" {
+		t.Errorf("got %v, want only the pending suite", reports)
+	}
+}
@@ -0,0 +1,371 @@
+package stage
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/version"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+//StageResult is the final document of a stage
+type StageResult struct {
+	ID                string                     `json:"id"`
+	Phase             Phase                      `json:"phase"`
+	DriverVersion     string                     `json:"driver_version"`
+	DBConfig          DBSettings                 `json:"db_config"`
+	StageConfig       Config                     `json:"stage_config"`
+	StartedAt         time.Time                  `json:"started_at"`
+	FinishedAt        time.Time                  `json:"finished_at"`
+	DurationSecs      float64                    `json:"duration_secs"`
+	LoadSecs          float64                    `json:"load_secs"`
+	QueryCount        int64                      `json:"query_count"`
+	Completed         int64                      `json:"completed"`
+	Timeouts          int64                      `json:"timeouts"`
+	TimeoutPercentage string                     `json:"timeout_percentage"`
+	ErrorCount        int64                      `json:"errors"`
+	ErrorPercentage   string                     `json:"error_percentage"`
+	Throughput        float64                    `json:"throughput"`
+	Dropped           int64                      `json:"dropped"`
+	Late              int64                      `json:"late"`
+	Errors            map[string]int64           `json:"error_breakdown"`
+	Latency           stats.LatencySummary       `json:"latency"`
+	QueueWait         stats.LatencySummary       `json:"queue_wait"`
+	Operations        map[string]OperationResult `json:"operations"`
+	PoolStats         stats.PoolSnapshot         `json:"pool_stats"`
+	Commands          stats.CommandSnapshot      `json:"commands"`
+	OutsideCommandsMs float64                    `json:"outside_commands_ms"`
+	Topology          stats.ServerSnapshot       `json:"topology"`
+	Steps             []StepResult               `json:"steps"`
+	TimeSeries        []Sample                   `json:"timeseries"`
+	Search            *SearchResult              `json:"search,omitempty"`
+	Verdict           *Verdict                   `json:"verdict,omitempty"`
+	Error             string                     `json:"error,omitempty"`
+}
+
+//StepResult holds the counters of a single step of the stage
+type StepResult struct {
+	Step              int                        `json:"step"`
+	Name              string                     `json:"name,omitempty"`
+	Phase             Phase                      `json:"phase"`
+	Workers           int                        `json:"workers"`
+	Producers         int                        `json:"producers"`
+	StartedAt         time.Time                  `json:"started_at"`
+	FinishedAt        time.Time                  `json:"finished_at"`
+	Queries           int64                      `json:"queries"`
+	Timeouts          int64                      `json:"timeouts"`
+	TimeoutPercentage string                     `json:"timeout_percentage"`
+	ErrorCount        int64                      `json:"errors"`
+	ErrorPercentage   string                     `json:"error_percentage"`
+	Throughput        float64                    `json:"throughput"`
+	Dropped           int64                      `json:"dropped"`
+	Late              int64                      `json:"late"`
+	Errors            map[string]int64           `json:"error_breakdown"`
+	Latency           stats.LatencySummary       `json:"latency"`
+	QueueWait         stats.LatencySummary       `json:"queue_wait"`
+	Operations        map[string]OperationResult `json:"operations"`
+	PoolStats         stats.PoolSnapshot         `json:"pool_stats"`
+	TopologyEvents    int                        `json:"topology_events"`
+}
+
+//DBSettings echoes the database configuration used by the stage
+type DBSettings struct {
+	DbName            string                `json:"db_name"`
+	CollectionName    string                `json:"collection_name"`
+	ConnString        string                `json:"conn_string"`
+	MinPoolSize       uint64                `json:"min_pool_size"`
+	MaxPoolSize       uint64                `json:"max_pool_size"`
+	IdleTimeoutSecs   float64               `json:"idle_timeout"`
+	SocketTimeoutSecs float64               `json:"socket_timeout"`
+	WriteConcern      *WriteConcernSettings `json:"write_concern,omitempty"`
+	ReadPreference    ReadPreference        `json:"read_preference"`
+	ReadConcern       string                `json:"read_concern,omitempty"`
+}
+
+//WriteConcernSettings echoes the write concern used by the stage
+type WriteConcernSettings struct {
+	W          string `json:"w,omitempty"`
+	J          *bool  `json:"j,omitempty"`
+	WTimeoutMs int64  `json:"wtimeout,omitempty"`
+}
+
+func newDBSettings(config repositories.MongoDBConfiguration) DBSettings {
+	settings := DBSettings{
+		DbName:            config.DbName,
+		CollectionName:    config.CollectionName,
+		ConnString:        redactConnString(config.ConnString),
+		MinPoolSize:       config.MinPool,
+		MaxPoolSize:       config.MaxPool,
+		IdleTimeoutSecs:   config.IdleTimeout.Seconds(),
+		SocketTimeoutSecs: config.SocketTimeout.Seconds(),
+		ReadPreference:    ReadPreference{Mode: repositories.DefaultReadPreference},
+		ReadConcern:       config.ReadConcern,
+	}
+	if readPreference := config.ReadPreference; readPreference != nil {
+		settings.ReadPreference = ReadPreference{
+			Mode:                readPreference.Mode,
+			TagSets:             readPreference.TagSets,
+			MaxStalenessSeconds: uint(readPreference.MaxStaleness / time.Second),
+		}
+	}
+	if config.WriteConcern != nil {
+		settings.WriteConcern = &WriteConcernSettings{
+			W:          config.WriteConcern.W,
+			J:          config.WriteConcern.J,
+			WTimeoutMs: config.WriteConcern.WTimeout.Milliseconds(),
+		}
+	}
+	return settings
+}
+
+//redactConnString hides the password of the connection string
+func redactConnString(connString string) string {
+	schemeEnd := strings.Index(connString, "://")
+	if schemeEnd < 0 {
+		return connString
+	}
+	rest := connString[schemeEnd+3:]
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return connString
+	}
+	userInfo := rest[:at]
+	if colon := strings.Index(userInfo, ":"); colon >= 0 {
+		userInfo = userInfo[:colon] + ":****"
+	}
+	return connString[:schemeEnd+3] + userInfo + rest[at:]
+}
+
+//Result returns the final document of the stage, false if it is still running
+func (s *Stage) Result() (*StageResult, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.result, s.result != nil
+}
+
+func (s *Stage) startStep(phase Phase, step int, name string, workers int, producers int) {
+	s.closeStep()
+
+	s.mutex.Lock()
+	s.phase = phase
+	s.step = step
+	s.workers = workers
+	s.producers = producers
+	s.currentStep = &StepResult{
+		Step:      step,
+		Name:      name,
+		Phase:     phase,
+		Workers:   workers,
+		Producers: producers,
+		StartedAt: time.Now(),
+	}
+	s.publishPhase()
+	s.mutex.Unlock()
+}
+
+func (s *Stage) closeStep() {
+	counters := s.recorder.rotate()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.currentStep == nil {
+		return
+	}
+	step := s.currentStep
+	step.FinishedAt = time.Now()
+	step.Queries = counters.queries
+	step.Timeouts = counters.timeouts
+	step.TimeoutPercentage = TimeoutPercentage(counters.timeouts, counters.queries)
+	step.ErrorCount = counters.errors
+	step.ErrorPercentage = TimeoutPercentage(counters.errors, counters.queries)
+	step.Throughput = throughput(counters.queries, step.FinishedAt.Sub(step.StartedAt))
+	step.Dropped = counters.dropped
+	step.Late = counters.late
+	step.Errors = counters.errorKinds()
+	step.Latency = counters.latency.Summary()
+	step.QueueWait = counters.queueWait.Summary()
+	step.Operations = counters.operationResults()
+	step.PoolStats = s.poolStats.Snapshot()
+	//the pool events are kept once, in the stage pool stats
+	step.PoolStats.Events = nil
+	step.TopologyEvents = s.srvStats.EventsSince(step.StartedAt)
+
+	logrus.WithField("step", step.Step).Infof("%s step latency: %v", step.Phase, step.Latency)
+
+	var previousGetsFailed int64
+	if len(s.steps) > 0 {
+		previousGetsFailed = s.steps[len(s.steps)-1].PoolStats.GetsFailed
+	}
+	s.checkStep(*step, previousGetsFailed)
+	s.steps = append(s.steps, *step)
+	s.currentStep = nil
+}
+
+//endStep closes the current step and returns it
+func (s *Stage) endStep() StepResult {
+	s.closeStep()
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.steps[len(s.steps)-1]
+}
+
+//finish closes the stage with the given phase and builds its result
+func (s *Stage) finish(phase Phase, err error) *StageResult {
+	if s.stopSampling != nil {
+		s.stopSampling()
+	}
+	s.closeStep()
+	totals := s.recorder.snapshot()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.phase = phase
+	s.err = err
+	s.finishedAt = time.Now()
+
+	result := &StageResult{
+		ID:            s.id,
+		Phase:         phase,
+		DriverVersion: version.Driver,
+		DBConfig:      newDBSettings(s.dbConfig),
+		StageConfig:   s.stageConfig,
+		StartedAt:     s.startedAt,
+		FinishedAt:    s.finishedAt,
+		DurationSecs:  s.finishedAt.Sub(s.startedAt).Seconds(),
+		Completed:     totals.queries,
+		Timeouts:      totals.timeouts,
+		ErrorCount:    totals.errors,
+		Dropped:       totals.dropped,
+		Late:          totals.late,
+		Errors:        totals.kinds,
+		Latency:       totals.latency.Summary(),
+		QueueWait:     totals.queueWait.Summary(),
+		Operations:    totals.operationResults(),
+		PoolStats:     s.poolStats.Snapshot(),
+		Commands:      s.cmdStats.Snapshot(),
+		Topology:      s.srvStats.Snapshot(),
+		Steps:         append([]StepResult{}, s.steps...),
+		TimeSeries:    append([]Sample{}, s.timeseries...),
+	}
+	result.QueryCount = s.queryCount()
+	loadQueries, loadTime := loadWindow(result.Steps)
+	result.LoadSecs = loadTime.Seconds()
+	result.Throughput = throughput(loadQueries, loadTime)
+	result.Search = s.search
+	result.TimeoutPercentage = TimeoutPercentage(result.Timeouts, result.Completed)
+	result.ErrorPercentage = TimeoutPercentage(result.ErrorCount, result.Completed)
+	result.OutsideCommandsMs = timeOutsideCommands(totals.latency, totals.queueWait, result.Commands)
+	result.Verdict = s.verdict(result)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	s.result = result
+	s.publishPhase()
+	s.closeSubscribers()
+	close(s.done)
+	return result
+}
+
+//timeOutsideCommands is the latency of every query, without the time waiting for a worker in the open loop mode,
+//minus the round trips of every command, divided by the queries. It is a single aggregate of the stage, the
+//commands are not matched to their query
+func timeOutsideCommands(latency *stats.Histogram, queueWait *stats.Histogram, commands stats.CommandSnapshot) float64 {
+	if latency.Count() == 0 {
+		return 0
+	}
+	outside := float64(latency.Sum()-queueWait.Sum())/1000 - commands.TotalDuration()
+	if outside < 0 {
+		return 0
+	}
+	return outside / float64(latency.Count())
+}
+
+func sortedOperations(operations map[string]OperationResult) []string {
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//loadWindow returns the queries completed during the load steps and their duration, the seeding, the draining
+//and the time between the runs of a search are left out
+func loadWindow(steps []StepResult) (int64, time.Duration) {
+	var queries int64
+	var elapsed time.Duration
+	for _, step := range steps {
+		if step.Phase == PhaseDraining {
+			continue
+		}
+		queries += step.Queries
+		elapsed += step.FinishedAt.Sub(step.StartedAt)
+	}
+	return queries, elapsed
+}
+
+func throughput(queries int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(queries) / elapsed.Seconds()
+}
+
+func logResult(result *StageResult) {
+	logrus.Printf("")
+	logrus.Printf("--------------------------------------------------------------------------------------------------------------")
+	logrus.Printf("Final stats: %+v", result.PoolStats)
+	logrus.Printf("--------------------------------------------------------------------------------------------------------------")
+	logrus.Printf("")
+
+	logrus.Printf("************************************")
+	logrus.Printf("Total query count: %d", result.QueryCount)
+	logrus.Printf("Total query timeouts: %d", result.Timeouts)
+	logrus.Printf("Timeout percentage: %s", result.TimeoutPercentage)
+	logrus.Printf("Total query errors: %d (%s) %v", result.ErrorCount, result.ErrorPercentage, result.Errors)
+	logrus.Printf("Latency: %v", result.Latency)
+	if result.StageConfig.LoadModel == LoadModelOpen {
+		logrus.Printf("Queue wait: %v", result.QueueWait)
+		logrus.Printf("Dropped requests: %d, late requests: %d", result.Dropped, result.Late)
+	}
+	for _, name := range sortedOperations(result.Operations) {
+		operation := result.Operations[name]
+		logrus.Printf("  %s: queries=%d, errors=%d, latency=%v", name, operation.Queries, operation.Errors, operation.Latency)
+	}
+	logrus.Printf("Commands: %v", result.Commands)
+	logrus.Printf("Time outside the commands by query: %.2fms", result.OutsideCommandsMs)
+	logrus.Printf("Topology: %v", result.Topology)
+	if result.Search != nil {
+		for _, run := range result.Search.Runs {
+			if run.Saturation != nil {
+				logrus.Printf("Search with max pool size %d: saturation at %s=%.0f (%.1f queries by second, p99=%.2fms) %s",
+					run.MaxPoolSize, result.Search.Variable, run.Saturation.Value, run.Saturation.Throughput, run.Saturation.P99Ms, run.Violation)
+			} else {
+				logrus.Printf("Search with max pool size %d: no point within the limits %s", run.MaxPoolSize, run.Violation)
+			}
+			if run.Knee != nil {
+				logrus.Printf("  latency knee at %s=%.0f (p99=%.2fms)", result.Search.Variable, run.Knee.Value, run.Knee.P99Ms)
+			}
+		}
+		logrus.Printf("Best max pool size: %d", result.Search.BestPoolSize)
+	}
+	if result.Verdict != nil {
+		logrus.Printf("SLO verdict: passed=%t, %d violations", result.Verdict.Passed, len(result.Verdict.Violations))
+		for _, violation := range result.Verdict.Violations {
+			if violation.Step == 0 {
+				logrus.Printf("  %s: actual %.2f", violation.Assertion, violation.Actual)
+			} else {
+				logrus.Printf("  %s: actual %.2f in step %d %s", violation.Assertion, violation.Actual, violation.Step, violation.StepName)
+			}
+		}
+	}
+	logrus.Printf("************************************")
+}
@@ -0,0 +1,62 @@
+package stage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stats"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestLoadWindow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	steps := []StepResult{
+		{Phase: PhaseRamping, StartedAt: start, FinishedAt: start.Add(10 * time.Second), Queries: 100},
+		{Phase: PhaseHolding, StartedAt: start.Add(10 * time.Second), FinishedAt: start.Add(30 * time.Second), Queries: 400},
+		{Phase: PhaseDraining, StartedAt: start.Add(30 * time.Second), FinishedAt: start.Add(32 * time.Second), Queries: 20},
+		//a second search run after a reconnection, the gap is left out
+		{Phase: PhaseSearching, StartedAt: start.Add(60 * time.Second), FinishedAt: start.Add(70 * time.Second), Queries: 100},
+	}
+
+	queries, elapsed := loadWindow(steps)
+	if queries != 600 {
+		t.Errorf("queries: got %d, want 600", queries)
+	}
+	if elapsed != 40*time.Second {
+		t.Errorf("elapsed: got %v, want 40s", elapsed)
+	}
+	if got := throughput(queries, elapsed); got != 15 {
+		t.Errorf("throughput: got %v, want 15", got)
+	}
+}
+
+func TestThroughputWithoutLoad(t *testing.T) {
+	queries, elapsed := loadWindow(nil)
+	if got := throughput(queries, elapsed); got != 0 {
+		t.Errorf("throughput without steps: got %v, want 0", got)
+	}
+}
+
+func TestTimeOutsideCommands(t *testing.T) {
+	latency := stats.NewHistogram()
+	latency.RecordMs(10)
+	latency.RecordMs(20)
+	queueWait := stats.NewHistogram()
+	queueWait.RecordMs(4)
+	commandStats := stats.NewCommandStats()
+	commandStats.Started(context.Background(), &event.CommandStartedEvent{CommandName: "find", RequestID: 1})
+	commandStats.Succeeded(context.Background(), &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, DurationNanos: int64(16 * time.Millisecond)},
+	})
+
+	//30ms of latency, 4ms waiting for a worker and 16ms in the find
+	if got := timeOutsideCommands(latency, queueWait, commandStats.Snapshot()); math.Abs(got-5) > 0.1 {
+		t.Errorf("got %vms, want 5ms by query", got)
+	}
+	if got := timeOutsideCommands(stats.NewHistogram(), queueWait, commandStats.Snapshot()); got != 0 {
+		t.Errorf("no queries: got %vms", got)
+	}
+}
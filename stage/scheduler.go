@@ -0,0 +1,170 @@
+package stage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//Scheduler runs the submitted stages one at a time, in submission order, so they never share the
+//collection nor drop each other's data
+type Scheduler struct {
+	queue    []queuedStage
+	running  string
+	wake     chan struct{}
+	onFinish func(*StageResult)
+	mutex    sync.Mutex
+}
+
+type queuedStage struct {
+	id    string
+	stage *Stage
+}
+
+//NewScheduler creates a scheduler and starts running the stages submitted to it, onFinish is called
+//with the result of every stage it runs, nil to ignore them
+func NewScheduler(ctx context.Context, onFinish func(*StageResult)) *Scheduler {
+	scheduler := &Scheduler{
+		wake:     make(chan struct{}, 1),
+		onFinish: onFinish,
+	}
+	go scheduler.run(ctx)
+	return scheduler
+}
+
+//Submit queues a stage under the given id and returns its position, the running stage is not in the queue:
+//1 is the next one to run once the running stage, if any, is done
+func (s *Scheduler) Submit(id string, stage *Stage) int {
+	s.mutex.Lock()
+	s.queue = append(s.queue, queuedStage{id: id, stage: stage})
+	position := len(s.queue)
+	stage.setQueuePosition(position)
+	s.mutex.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	logrus.WithField("stage", id).Printf("Stage queued at position %d", position)
+	return position
+}
+
+//Remove takes a stage out of the queue, it finishes as cancelled without running and its result goes
+//to onFinish like the ones that ran. Returns false if the stage is not queued
+func (s *Scheduler) Remove(id string) bool {
+	s.mutex.Lock()
+	var removed *Stage
+	for i, queued := range s.queue {
+		if queued.id == id {
+			removed = queued.stage
+			s.queue = append(s.queue[:i], s.queue[i+1:]...)
+			break
+		}
+	}
+	s.updatePositions()
+	s.mutex.Unlock()
+
+	if removed == nil {
+		return false
+	}
+	result := removed.skip(id)
+	logrus.WithField("stage", id).Printf("Stage removed from the queue")
+	if s.onFinish != nil {
+		s.onFinish(result)
+	}
+	return true
+}
+
+//Queue returns the ids of the queued stages, in running order
+func (s *Scheduler) Queue() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := make([]string, 0, len(s.queue))
+	for _, queued := range s.queue {
+		ids = append(ids, queued.id)
+	}
+	return ids
+}
+
+//Running returns the id of the running stage, empty when there is none
+func (s *Scheduler) Running() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.running
+}
+
+func (s *Scheduler) run(ctx context.Context) {
+	for {
+		next, ok := s.next()
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+		result := next.stage.Run(ctx, next.id)
+		if s.onFinish != nil {
+			s.onFinish(result)
+		}
+
+		s.mutex.Lock()
+		s.running = ""
+		s.mutex.Unlock()
+	}
+}
+
+//next pops the first stage of the queue, false when it is empty
+func (s *Scheduler) next() (queuedStage, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if len(s.queue) == 0 {
+		return queuedStage{}, false
+	}
+	next := s.queue[0]
+	s.queue = s.queue[1:]
+	s.running = next.id
+	next.stage.setQueuePosition(0)
+	s.updatePositions()
+	return next, true
+}
+
+//updatePositions tells every queued stage its position, the caller holds the mutex
+func (s *Scheduler) updatePositions() {
+	for i, queued := range s.queue {
+		queued.stage.setQueuePosition(i + 1)
+	}
+}
+
+//setQueuePosition moves a pending stage into the queue, or out of it with position 0
+func (s *Stage) setQueuePosition(position int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.phase != PhasePending && s.phase != PhaseQueued {
+		return
+	}
+	s.queuePosition = position
+	s.phase = PhasePending
+	if position > 0 {
+		s.phase = PhaseQueued
+	}
+	s.publishPhase()
+}
+
+//skip finishes a stage removed from the queue without running it
+func (s *Stage) skip(id string) *StageResult {
+	s.mutex.Lock()
+	s.id = id
+	s.cancelled = true
+	s.queuePosition = 0
+	s.startedAt = time.Now()
+	s.mutex.Unlock()
+
+	return s.finish(PhaseCancelled, nil)
+}
@@ -0,0 +1,86 @@
+package stage
+
+import (
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+//idleScheduler does not run the stages, so they stay queued
+func idleScheduler(onFinish func(*StageResult)) *Scheduler {
+	return &Scheduler{wake: make(chan struct{}, 1), onFinish: onFinish}
+}
+
+func TestSchedulerPositions(t *testing.T) {
+	scheduler := idleScheduler(nil)
+	first := New(repositories.MongoDBConfiguration{}, Config{})
+	second := New(repositories.MongoDBConfiguration{}, Config{})
+
+	if position := scheduler.Submit("first", first); position != 1 {
+		t.Errorf("first: got position %d, want 1", position)
+	}
+	if position := scheduler.Submit("second", second); position != 2 {
+		t.Errorf("second: got position %d, want 2", position)
+	}
+	if status := second.Status(); status.Phase != PhaseQueued || status.QueuePosition != 2 {
+		t.Errorf("second: got %s at %d, want queued at 2", status.Phase, status.QueuePosition)
+	}
+
+	scheduler.Remove("first")
+	if status := second.Status(); status.QueuePosition != 1 {
+		t.Errorf("second after removing the first: got position %d, want 1", status.QueuePosition)
+	}
+}
+
+func TestSchedulerRemoveFinishesTheStage(t *testing.T) {
+	var finished []*StageResult
+	scheduler := idleScheduler(func(result *StageResult) { finished = append(finished, result) })
+	queued := New(repositories.MongoDBConfiguration{}, Config{})
+	scheduler.Submit("queued", queued)
+
+	if !scheduler.Remove("queued") {
+		t.Fatal("expected the stage to be removed")
+	}
+	if scheduler.Remove("queued") {
+		t.Error("a stage can only be removed once")
+	}
+
+	if len(finished) != 1 {
+		t.Fatalf("onFinish: got %d results, want 1", len(finished))
+	}
+	if result := finished[0]; result.ID != "queued" || result.Phase != PhaseCancelled {
+		t.Errorf("got %s %s, want queued cancelled", result.ID, result.Phase)
+	}
+	select {
+	case <-queued.Done():
+	default:
+		t.Error("the removed stage is not done")
+	}
+	if len(scheduler.Queue()) != 0 {
+		t.Errorf("queue: got %v, want empty", scheduler.Queue())
+	}
+}
+
+func TestSchedulerPublishesTheQueuePosition(t *testing.T) {
+	scheduler := idleScheduler(nil)
+	first := New(repositories.MongoDBConfiguration{}, Config{})
+	second := New(repositories.MongoDBConfiguration{}, Config{})
+	scheduler.Submit("first", first)
+	scheduler.Submit("second", second)
+
+	events, unsubscribe := second.Subscribe()
+	defer unsubscribe()
+	if change := (<-events).Data.(PhaseChange); change.Phase != PhaseQueued || change.QueuePosition != 2 {
+		t.Fatalf("got %s at %d, want queued at 2", change.Phase, change.QueuePosition)
+	}
+
+	scheduler.Remove("first")
+	select {
+	case event := <-events:
+		if change := event.Data.(PhaseChange); event.Name != EventPhase || change.Phase != PhaseQueued || change.QueuePosition != 1 {
+			t.Errorf("got %s %s at %d, want a phase event queued at 1", event.Name, change.Phase, change.QueuePosition)
+		}
+	default:
+		t.Error("no event when the stage moved in the queue")
+	}
+}
@@ -0,0 +1,223 @@
+package stage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+//Variables the search can move
+const (
+	SearchRate    = "rate"
+	SearchWorkers = "workers"
+)
+
+//SearchConfig moves the rate or the workers from start to max, step by step, until the latency or the errors
+//of a step go over the limits. With pool sizes the search runs once for each max pool size
+type SearchConfig struct {
+	Variable           string  `json:"variable"`
+	Start              uint    `json:"start"`
+	Step               uint    `json:"step"`
+	Max                uint    `json:"max"`
+	StepDurationSecs   uint    `json:"step_duration_secs"`
+	MaxP99Ms           float64 `json:"max_p99_ms,omitempty"`
+	MaxErrorPercentage float64 `json:"max_error_percentage,omitempty"`
+	PoolSizes          []uint  `json:"pool_sizes,omitempty"`
+}
+
+//SearchResult holds every search run of the stage and the best one
+type SearchResult struct {
+	Variable string      `json:"variable"`
+	Runs     []SearchRun `json:"runs"`
+	//BestPoolSize is the max pool size of the run with the highest saturation throughput
+	BestPoolSize uint64 `json:"best_pool_size"`
+}
+
+//SearchRun is a search with a single max pool size
+type SearchRun struct {
+	MaxPoolSize uint64        `json:"max_pool_size"`
+	Points      []SearchPoint `json:"points"`
+	//Saturation is the last point within the limits, nil when the first one went over them
+	Saturation *SearchPoint `json:"saturation"`
+	//Knee is the point where the p99 latency starts growing faster than the load
+	Knee *SearchPoint `json:"knee"`
+	//Violation is why the search stopped, empty when it reached max
+	Violation string `json:"violation,omitempty"`
+}
+
+//SearchPoint is the outcome of a step of the search
+type SearchPoint struct {
+	Value           float64 `json:"value"`
+	Throughput      float64 `json:"throughput"`
+	P99Ms           float64 `json:"p99_ms"`
+	ErrorPercentage float64 `json:"error_percentage"`
+	Passed          bool    `json:"passed"`
+}
+
+//ValidateSearch checks the search config
+func ValidateSearch(search *SearchConfig) error {
+	if search == nil {
+		return nil
+	}
+	if search.Variable != SearchRate && search.Variable != SearchWorkers {
+		return fmt.Errorf("variable must be %s or %s", SearchRate, SearchWorkers)
+	}
+	if search.Start == 0 || search.Step == 0 || search.Max < search.Start {
+		return fmt.Errorf("start and step are required and max can not be lower than start")
+	}
+	if search.StepDurationSecs == 0 {
+		return fmt.Errorf("step_duration_secs is required")
+	}
+	if search.MaxP99Ms <= 0 && search.MaxErrorPercentage <= 0 {
+		return fmt.Errorf("max_p99_ms or max_error_percentage is required")
+	}
+	for _, poolSize := range search.PoolSizes {
+		if poolSize == 0 {
+			return fmt.Errorf("pool sizes must be greater than 0")
+		}
+	}
+	return nil
+}
+
+//steps returns the maximum number of steps of the search for a single pool size
+func (c *SearchConfig) steps() int {
+	return int((c.Max-c.Start)/c.Step) + 1
+}
+
+//steps returns the number of steps of the stage, the search stops early when it goes over the limits
+func (c Config) steps() int {
+	//every run ends with its own draining step
+	if c.Search != nil {
+		return (c.Search.steps() + 1) * len(c.poolSizes(0))
+	}
+	return len(c.profile()) + 1
+}
+
+//poolSizes returns the max pool sizes of the stage runs, a single one without a search
+func (c Config) poolSizes(defaultSize uint64) []uint64 {
+	if c.Search == nil || len(c.Search.PoolSizes) == 0 {
+		return []uint64{defaultSize}
+	}
+	var sizes []uint64
+	for _, size := range c.Search.PoolSizes {
+		sizes = append(sizes, uint64(size))
+	}
+	return sizes
+}
+
+func (s *Stage) runSearch(ctx context.Context, repo repositories.TestRepository, load *load, maxPoolSize uint64) {
+	search := s.stageConfig.Search
+	run := SearchRun{MaxPoolSize: maxPoolSize}
+
+	for value := search.Start; value <= search.Max && ctx.Err() == nil; value += search.Step {
+		if search.Variable == SearchRate {
+			load.setRate(float64(value))
+		} else {
+			load.setWorkers(int(value))
+		}
+		workers, producers, rate := load.counts()
+		s.setCounts(workers, producers)
+
+		name := fmt.Sprintf("pool=%d %s=%d", maxPoolSize, search.Variable, value)
+		s.startStep(PhaseSearching, s.stepNumber()+1, name, workers, producers)
+		logrus.Printf("Searching with max pool size %d: %d workers and %.0f requests by second for %d seconds",
+			maxPoolSize, workers, rate, search.StepDurationSecs)
+		for i := 0; i < int(search.StepDurationSecs) && ctx.Err() == nil; i++ {
+			logrus.WithField("executed", repo.QueryCount()).Infof("%v", s.poolStats)
+			sleep(ctx, 1*time.Second)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		step := s.endStep()
+		point := SearchPoint{
+			Value:           float64(value),
+			Throughput:      step.Throughput,
+			P99Ms:           step.Latency.P99Ms,
+			ErrorPercentage: percentage(step.ErrorCount+step.Dropped, step.Queries+step.Dropped),
+		}
+		run.Violation = search.violation(point)
+		point.Passed = run.Violation == ""
+		run.Points = append(run.Points, point)
+		logrus.WithField("step", step.Step).Infof("Search point %s: throughput=%.1f, p99=%.2fms, errors=%.2f%% %s",
+			name, point.Throughput, point.P99Ms, point.ErrorPercentage, run.Violation)
+
+		if !point.Passed {
+			break
+		}
+		saturation := point
+		run.Saturation = &saturation
+	}
+	run.Knee = knee(run.Points)
+
+	s.addSearchRun(run)
+}
+
+func (c *SearchConfig) violation(point SearchPoint) string {
+	if c.MaxP99Ms > 0 && point.P99Ms > c.MaxP99Ms {
+		return fmt.Sprintf("p99 %.2fms over %.2fms", point.P99Ms, c.MaxP99Ms)
+	}
+	if c.MaxErrorPercentage > 0 && point.ErrorPercentage > c.MaxErrorPercentage {
+		return fmt.Sprintf("errors %.2f%% over %.2f%%", point.ErrorPercentage, c.MaxErrorPercentage)
+	}
+	return ""
+}
+
+func (s *Stage) addSearchRun(run SearchRun) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.search == nil {
+		s.search = &SearchResult{Variable: s.stageConfig.Search.Variable}
+	}
+	s.search.Runs = append(s.search.Runs, run)
+
+	var best float64
+	for _, searchRun := range s.search.Runs {
+		if searchRun.Saturation != nil && searchRun.Saturation.Throughput > best {
+			best = searchRun.Saturation.Throughput
+			s.search.BestPoolSize = searchRun.MaxPoolSize
+		}
+	}
+}
+
+//knee returns the point of the latency curve farthest below the line joining its first and last points,
+//both axes normalized, nil with less than 3 points
+func knee(points []SearchPoint) *SearchPoint {
+	if len(points) < 3 {
+		return nil
+	}
+	first, last := points[0], points[len(points)-1]
+	valueRange := last.Value - first.Value
+	latencyRange := last.P99Ms - first.P99Ms
+	if valueRange <= 0 || latencyRange <= 0 {
+		return nil
+	}
+
+	index, farthest := -1, 0.0
+	for i := 1; i < len(points)-1; i++ {
+		x := (points[i].Value - first.Value) / valueRange
+		y := (points[i].P99Ms - first.P99Ms) / latencyRange
+		if distance := x - y; distance > farthest {
+			index, farthest = i, distance
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+	point := points[index]
+	return &point
+}
+
+//percentage of count over total, not rounded so it can be compared against the limits
+func percentage(count int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(count) / float64(total)
+}
@@ -0,0 +1,87 @@
+package stage
+
+import (
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+func searchPoints(p99s ...float64) []SearchPoint {
+	var points []SearchPoint
+	for i, p99 := range p99s {
+		points = append(points, SearchPoint{Value: float64(100 * (i + 1)), P99Ms: p99})
+	}
+	return points
+}
+
+func TestKnee(t *testing.T) {
+	//the latency stays flat up to 400 and then climbs
+	point := knee(searchPoints(5, 5, 6, 7, 20, 60))
+	if point == nil || point.Value != 400 {
+		t.Errorf("got %+v, want the point at 400", point)
+	}
+}
+
+func TestKneeWithoutCurve(t *testing.T) {
+	tests := map[string][]SearchPoint{
+		"two points":      searchPoints(5, 50),
+		"straight line":   searchPoints(10, 20, 30, 40),
+		"latency falling": searchPoints(50, 40, 30),
+		"flat latency":    searchPoints(5, 5, 5),
+		"above the line":  searchPoints(5, 40, 45, 50),
+	}
+	for name, points := range tests {
+		if point := knee(points); point != nil {
+			t.Errorf("%s: got %+v, want none", name, point)
+		}
+	}
+}
+
+func TestValidateSearch(t *testing.T) {
+	valid := SearchConfig{Variable: SearchRate, Start: 100, Step: 100, Max: 1000, StepDurationSecs: 10, MaxP99Ms: 50}
+	if err := ValidateSearch(&valid); err != nil {
+		t.Errorf("valid search: %v", err)
+	}
+	if err := ValidateSearch(nil); err != nil {
+		t.Errorf("no search: %v", err)
+	}
+
+	for name, change := range map[string]func(*SearchConfig){
+		"variable":    func(c *SearchConfig) { c.Variable = "producers" },
+		"no step":     func(c *SearchConfig) { c.Step = 0 },
+		"max too low": func(c *SearchConfig) { c.Max = 50 },
+		"no duration": func(c *SearchConfig) { c.StepDurationSecs = 0 },
+		"no limits":   func(c *SearchConfig) { c.MaxP99Ms = 0 },
+		"empty pool":  func(c *SearchConfig) { c.PoolSizes = []uint{10, 0} },
+	} {
+		search := valid
+		change(&search)
+		if err := ValidateSearch(&search); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSearchViolation(t *testing.T) {
+	search := SearchConfig{MaxP99Ms: 50, MaxErrorPercentage: 1}
+	if violation := search.violation(SearchPoint{P99Ms: 50, ErrorPercentage: 1}); violation != "" {
+		t.Errorf("at the limits: got %q, want none", violation)
+	}
+	if violation := search.violation(SearchPoint{P99Ms: 50.01}); violation == "" {
+		t.Error("over the p99: expected a violation")
+	}
+	if violation := search.violation(SearchPoint{ErrorPercentage: 1.001}); violation == "" {
+		t.Error("over the errors: expected a violation")
+	}
+}
+
+func TestBestPoolSize(t *testing.T) {
+	s := New(repositories.MongoDBConfiguration{}, Config{Search: &SearchConfig{Variable: SearchWorkers}})
+	s.addSearchRun(SearchRun{MaxPoolSize: 10, Saturation: &SearchPoint{Throughput: 900}})
+	s.addSearchRun(SearchRun{MaxPoolSize: 20, Saturation: &SearchPoint{Throughput: 1200}})
+	s.addSearchRun(SearchRun{MaxPoolSize: 40})
+
+	if s.search.BestPoolSize != 20 || len(s.search.Runs) != 3 || s.search.Variable != SearchWorkers {
+		t.Errorf("got %+v, want the pool size 20 as the best of 3 runs", s.search)
+	}
+}
@@ -0,0 +1,201 @@
+package stage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+//operators of the assertions, the two character ones first so they are matched before < and >
+var operators = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+//metricAliases lets the assertions use a more natural name for a metric
+var metricAliases = map[string]string{
+	"min_throughput": "throughput",
+	"max_throughput": "throughput",
+}
+
+//Assertion is a threshold on a metric of the stage, "p99_ms < 50"
+type Assertion struct {
+	Raw      string
+	Metric   string
+	Operator string
+	Value    float64
+}
+
+//Verdict of the assertions of a stage
+type Verdict struct {
+	Passed     bool        `json:"passed"`
+	Assertions []string    `json:"assertions"`
+	Violations []Violation `json:"violations"`
+}
+
+//Violation of an assertion by the whole stage (step 0) or by one of its steps
+type Violation struct {
+	Assertion string  `json:"assertion"`
+	Step      int     `json:"step,omitempty"`
+	StepName  string  `json:"step_name,omitempty"`
+	Actual    float64 `json:"actual"`
+}
+
+//ParseAssertion parses "<metric> <operator> <value>", the value may end with % or /s
+func ParseAssertion(raw string) (Assertion, error) {
+	for _, operator := range operators {
+		index := strings.Index(raw, operator)
+		if index < 0 {
+			continue
+		}
+		metric := strings.TrimSpace(raw[:index])
+		if alias, ok := metricAliases[metric]; ok {
+			metric = alias
+		}
+		if _, ok := metricNames[metric]; !ok {
+			return Assertion{}, fmt.Errorf("unknown metric '%s' in '%s', expected one of %v", metric, raw, MetricNames())
+		}
+
+		valueString := strings.TrimSpace(raw[index+len(operator):])
+		valueString = strings.TrimSuffix(strings.TrimSuffix(valueString, "%"), "/s")
+		value, err := strconv.ParseFloat(strings.TrimSpace(valueString), 64)
+		if err != nil {
+			return Assertion{}, fmt.Errorf("invalid value in '%s'", raw)
+		}
+		//every metric is a latency, a rate or a count
+		if value < 0 {
+			return Assertion{}, fmt.Errorf("negative value in '%s'", raw)
+		}
+		return Assertion{Raw: raw, Metric: metric, Operator: operator, Value: value}, nil
+	}
+	return Assertion{}, fmt.Errorf("no operator in '%s', expected one of %v", raw, operators)
+}
+
+//ValidateAssertions checks every assertion can be parsed
+func ValidateAssertions(assertions []string) error {
+	for _, raw := range assertions {
+		if _, err := ParseAssertion(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//holds tells if the actual value of the metric satisfies the assertion
+func (a Assertion) holds(actual float64) bool {
+	switch a.Operator {
+	case "<":
+		return actual < a.Value
+	case "<=":
+		return actual <= a.Value
+	case ">":
+		return actual > a.Value
+	case ">=":
+		return actual >= a.Value
+	case "==":
+		return actual == a.Value
+	case "!=":
+		return actual != a.Value
+	}
+	return false
+}
+
+//metricNames are the metrics the assertions can use
+var metricNames = map[string]bool{
+	"p50_ms": true, "p90_ms": true, "p99_ms": true, "p999_ms": true, "max_ms": true, "mean_ms": true,
+	"error_rate": true, "timeout_rate": true, "errors": true, "timeouts": true, "dropped": true, "late": true,
+	"throughput": true, "gets_failed": true, "queries": true,
+}
+
+//MetricNames returns the metrics the assertions can use
+func MetricNames() []string {
+	names := make([]string, 0, len(metricNames))
+	for name := range metricNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func stepMetrics(step StepResult, getsFailed int64) map[string]float64 {
+	return map[string]float64{
+		"p50_ms":       step.Latency.P50Ms,
+		"p90_ms":       step.Latency.P90Ms,
+		"p99_ms":       step.Latency.P99Ms,
+		"p999_ms":      step.Latency.P999Ms,
+		"max_ms":       step.Latency.MaxMs,
+		"mean_ms":      step.Latency.MeanMs,
+		"error_rate":   percentage(step.ErrorCount, step.Queries),
+		"timeout_rate": percentage(step.Timeouts, step.Queries),
+		"errors":       float64(step.ErrorCount),
+		"timeouts":     float64(step.Timeouts),
+		"dropped":      float64(step.Dropped),
+		"late":         float64(step.Late),
+		"throughput":   step.Throughput,
+		"gets_failed":  float64(getsFailed),
+		"queries":      float64(step.Queries),
+	}
+}
+
+func resultMetrics(result *StageResult) map[string]float64 {
+	return map[string]float64{
+		"p50_ms":       result.Latency.P50Ms,
+		"p90_ms":       result.Latency.P90Ms,
+		"p99_ms":       result.Latency.P99Ms,
+		"p999_ms":      result.Latency.P999Ms,
+		"max_ms":       result.Latency.MaxMs,
+		"mean_ms":      result.Latency.MeanMs,
+		"error_rate":   percentage(result.ErrorCount, result.Completed),
+		"timeout_rate": percentage(result.Timeouts, result.Completed),
+		"errors":       float64(result.ErrorCount),
+		"timeouts":     float64(result.Timeouts),
+		"dropped":      float64(result.Dropped),
+		"late":         float64(result.Late),
+		"throughput":   result.Throughput,
+		"gets_failed":  float64(result.PoolStats.GetsFailed),
+		"queries":      float64(result.Completed),
+	}
+}
+
+//violations evaluates the assertions against the metrics, step is 0 for the whole stage. The rates are not rounded,
+//0.004% does not hold "error_rate < 0.001%"
+func violations(assertions []string, metrics map[string]float64, step int, stepName string) []Violation {
+	var result []Violation
+	for _, raw := range assertions {
+		assertion, err := ParseAssertion(raw)
+		if err != nil {
+			continue
+		}
+		actual := metrics[assertion.Metric]
+		if !assertion.holds(actual) {
+			result = append(result, Violation{Assertion: assertion.Raw, Step: step, StepName: stepName, Actual: actual})
+		}
+	}
+	return result
+}
+
+//checkStep evaluates the assertions against a load step, the draining and search steps are left out.
+//The caller holds the mutex
+func (s *Stage) checkStep(step StepResult, previousGetsFailed int64) {
+	if len(s.stageConfig.SLOs) == 0 || (step.Phase != PhaseRamping && step.Phase != PhaseHolding) {
+		return
+	}
+	stepViolations := violations(s.stageConfig.SLOs, stepMetrics(step, step.PoolStats.GetsFailed-previousGetsFailed), step.Step, step.Name)
+	for _, violation := range stepViolations {
+		logrus.WithField("step", step.Step).Warnf("SLO violated: %s (actual %.2f)", violation.Assertion, violation.Actual)
+	}
+	s.violations = append(s.violations, stepViolations...)
+}
+
+//verdict evaluates the assertions against the whole stage and adds the step violations, nil without assertions
+func (s *Stage) verdict(result *StageResult) *Verdict {
+	if len(s.stageConfig.SLOs) == 0 {
+		return nil
+	}
+	verdict := &Verdict{
+		Assertions: s.stageConfig.SLOs,
+		Violations: append(violations(s.stageConfig.SLOs, resultMetrics(result), 0, ""), s.violations...),
+	}
+	verdict.Passed = len(verdict.Violations) == 0
+	return verdict
+}
@@ -0,0 +1,120 @@
+package stage
+
+import (
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+func TestParseAssertion(t *testing.T) {
+	tests := []struct {
+		raw      string
+		metric   string
+		operator string
+		value    float64
+	}{
+		{"p99_ms < 50", "p99_ms", "<", 50},
+		{"p99_ms<=50", "p99_ms", "<=", 50},
+		{"error_rate < 0.5%", "error_rate", "<", 0.5},
+		{"min_throughput >= 2000/s", "throughput", ">=", 2000},
+		{"gets_failed == 0", "gets_failed", "==", 0},
+		{"timeouts != 3", "timeouts", "!=", 3},
+		{"queries > 10", "queries", ">", 10},
+	}
+	for _, test := range tests {
+		assertion, err := ParseAssertion(test.raw)
+		if err != nil {
+			t.Errorf("%q: %v", test.raw, err)
+			continue
+		}
+		if assertion.Metric != test.metric || assertion.Operator != test.operator || assertion.Value != test.value {
+			t.Errorf("%q: got %s %s %v, want %s %s %v", test.raw,
+				assertion.Metric, assertion.Operator, assertion.Value, test.metric, test.operator, test.value)
+		}
+	}
+}
+
+func TestParseAssertionErrors(t *testing.T) {
+	for _, raw := range []string{
+		"p99_ms 50",
+		"latency < 50",
+		"p99_ms < fast",
+		"p99_ms <= -1",
+		"error_rate < -0.1%",
+	} {
+		if _, err := ParseAssertion(raw); err == nil {
+			t.Errorf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestAssertionHolds(t *testing.T) {
+	tests := []struct {
+		raw    string
+		actual float64
+		holds  bool
+	}{
+		{"p99_ms < 50", 49.9, true},
+		{"p99_ms < 50", 50, false},
+		{"p99_ms <= 50", 50, true},
+		{"throughput >= 100", 99, false},
+		{"throughput > 100", 101, true},
+		{"errors == 0", 0, true},
+		{"errors != 0", 0, false},
+	}
+	for _, test := range tests {
+		assertion, err := ParseAssertion(test.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := assertion.holds(test.actual); got != test.holds {
+			t.Errorf("%q with %v: got %v, want %v", test.raw, test.actual, got, test.holds)
+		}
+	}
+}
+
+func TestErrorRateIsNotRounded(t *testing.T) {
+	result := &StageResult{Completed: 100000, QueryCount: 100000, ErrorCount: 4}
+
+	found := violations([]string{"error_rate < 0.001%"}, resultMetrics(result), 0, "")
+	if len(found) != 1 {
+		t.Fatalf("0.004%% errors: got %d violations, want 1", len(found))
+	}
+	if found[0].Actual != 0.004 {
+		t.Errorf("actual: got %v, want 0.004", found[0].Actual)
+	}
+}
+
+func TestErrorRateOverCompletedQueries(t *testing.T) {
+	//the queries still running when the stage ended are not in the rate
+	result := &StageResult{Completed: 90, QueryCount: 100, ErrorCount: 9}
+	if rate := resultMetrics(result)["error_rate"]; rate != 10 {
+		t.Errorf("error_rate: got %v, want 10", rate)
+	}
+	if queries := resultMetrics(result)["queries"]; queries != 90 {
+		t.Errorf("queries: got %v, want the 90 completed", queries)
+	}
+	step := StepResult{Queries: 90, ErrorCount: 9}
+	if rate := stepMetrics(step, 0)["error_rate"]; rate != 10 {
+		t.Errorf("step error_rate: got %v, want 10", rate)
+	}
+}
+
+func TestVerdict(t *testing.T) {
+	s := &Stage{stageConfig: Config{SLOs: []string{"p99_ms < 50", "gets_failed == 0"}}}
+	s.checkStep(StepResult{Step: 1, Phase: PhaseHolding, Latency: stats.LatencySummary{P99Ms: 60}}, 0)
+	//the draining step is left out
+	s.checkStep(StepResult{Step: 2, Phase: PhaseDraining, Latency: stats.LatencySummary{P99Ms: 90}}, 0)
+
+	verdict := s.verdict(&StageResult{Latency: stats.LatencySummary{P99Ms: 40}})
+	if verdict.Passed {
+		t.Error("expected the verdict to fail")
+	}
+	if len(verdict.Violations) != 1 || verdict.Violations[0].Step != 1 {
+		t.Errorf("got violations %+v, want only step 1", verdict.Violations)
+	}
+
+	if verdict := (&Stage{}).verdict(&StageResult{}); verdict != nil {
+		t.Errorf("without slos: got %+v, want nil", verdict)
+	}
+}
@@ -1,39 +1,95 @@
 package stage
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/event"
 
 	"github.com/andresneva/mongo_driver_test/repositories"
 	"github.com/andresneva/mongo_driver_test/stats"
 )
 
-var timeouts int64
-
 //Config struct
 type Config struct {
-	WorkersCount     uint
-	WorkersToAdd     uint
-	IncrementLoad    uint
-	ProducersCount   uint
-	MsgBySec         uint
-	TimeToSleepSecs  uint
-	TimeToFinishSecs uint
-	QueryTimeoutMs   uint
-	BatchSize        int32
-	CollectionSize   int
-	DocumentSize     int
+	WorkersCount     uint           `json:"workers_count"`
+	WorkersToAdd     uint           `json:"workers_to_add"`
+	IncrementLoad    uint           `json:"increment_load"`
+	ProducersCount   uint           `json:"producers_count"`
+	MsgBySec         uint           `json:"msg_by_sec"`
+	TimeToSleepSecs  uint           `json:"time_to_sleep_secs"`
+	TimeToFinishSecs uint           `json:"time_to_finish_secs"`
+	QueryTimeoutMs   uint           `json:"query_timeout_ms"`
+	BatchSize        int32          `json:"batch_size"`
+	CollectionSize   int            `json:"collection_size"`
+	DocumentSize     int            `json:"document_size_kb"`
+	Workload         []WorkloadItem `json:"workload"`
+	LoadModel        string         `json:"load_model,omitempty"`
+	TargetRate       uint           `json:"target_rate,omitempty"`
+	LateThresholdMs  uint           `json:"late_threshold_ms,omitempty"`
+	LoadProfile      []ProfilePhase `json:"load_profile,omitempty"`
+	Search           *SearchConfig  `json:"search,omitempty"`
+	SLOs             []string       `json:"slos,omitempty"`
+	Tags             []string       `json:"tags,omitempty"`
+}
+
+//Load models
+const (
+	//LoadModelClosed producers block when the workers fall behind, the offered load drops with the throughput
+	LoadModelClosed = "closed"
+	//LoadModelOpen requests are scheduled at a constant rate no matter how fast the workers are
+	LoadModelOpen = "open"
+)
+
+const defaultLateThreshold = 10 * time.Millisecond
+
+//request is sent by the producers to the workers
+type request struct {
+	//intended is when the request should have started, zero in the closed loop mode
+	intended time.Time
 }
 
 //Stage struct
 type Stage struct {
-	dbConfig    repositories.MongoDBConfiguration
-	stageConfig Config
+	id              string
+	dbConfig        repositories.MongoDBConfiguration
+	stageConfig     Config
+	poolStats       *stats.PoolStats
+	cmdStats        *stats.CommandStats
+	srvStats        *stats.ServerStats
+	repository      repositories.TestRepository
+	recorder        *recorder
+	phase           Phase
+	queuePosition   int
+	step            int
+	workers         int
+	producers       int
+	startedAt       time.Time
+	finishedAt      time.Time
+	err             error
+	currentStep     *StepResult
+	steps           []StepResult
+	search          *SearchResult
+	timeseries      []Sample
+	subscribers     map[chan Event]bool
+	publishedPhase  Phase
+	publishedStep   int
+	publishedQueue  int
+	stopSampling    func()
+	requests        chan request
+	violations      []Violation
+	result          *StageResult
+	previousQueries int64
+	load            *load
+	cancel          context.CancelFunc
+	cancelled       bool
+	done            chan struct{}
+	mutex           sync.RWMutex
 }
 
 //New stage
@@ -41,98 +97,264 @@ func New(
 	dbConfig repositories.MongoDBConfiguration,
 	stageConfig Config) *Stage {
 	return &Stage{
-		dbConfig:    dbConfig,
-		stageConfig: stageConfig,
+		dbConfig:       dbConfig,
+		stageConfig:    stageConfig,
+		poolStats:      stats.NewPoolStats(),
+		cmdStats:       stats.NewCommandStats(),
+		srvStats:       stats.NewServerStats(),
+		recorder:       newRecorder(),
+		phase:          PhasePending,
+		publishedPhase: PhasePending,
+		done:           make(chan struct{}),
 	}
 }
 
-//Run starts the test
-func (s *Stage) Run(id string) {
+//Done is closed once the stage is finished, failed or cancelled
+func (s *Stage) Done() <-chan struct{} {
+	return s.done
+}
+
+//doneBefore tells if the stage has a result since before the given time
+func (s *Stage) doneBefore(before time.Time) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.result != nil && s.finishedAt.Before(before)
+}
+
+//Timeouts returns the number of queries that timed out so far
+func (s *Stage) Timeouts() int64 {
+	return s.recorder.timeouts()
+}
+
+func (s *Stage) setID(id string) {
+	s.mutex.Lock()
+	s.id = id
+	s.mutex.Unlock()
+}
 
-	timeouts = 0
+//Cancel stops a pending or running stage, returns false if it was already done
+func (s *Stage) Cancel() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	statsMonitor := stats.NewPoolStats()
+	if s.phase == PhaseFinished || s.phase == PhaseFailed || s.phase == PhaseCancelled {
+		return false
+	}
+	s.cancelled = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return true
+}
+
+//ErrNotRunning is returned when the load of a stage that is not running is changed
+var ErrNotRunning = errors.New("stage is not running")
+
+//Scale changes the workers, the producers and the requests by second of a running stage, zero keeps the current
+//value. The next step of the load profile overrides them
+func (s *Stage) Scale(workers int, producers int, rate float64) error {
+	s.mutex.RLock()
+	id, load := s.id, s.load
+	s.mutex.RUnlock()
+	if load == nil {
+		return ErrNotRunning
+	}
+
+	//the load is stopped when the stage finishes between the read of s.load and the changes
+	var err error
+	if workers > 0 {
+		err = load.setWorkers(workers)
+	}
+	if producers > 0 && err == nil {
+		err = load.setProducers(producers)
+	}
+	if rate > 0 && err == nil {
+		err = load.setRate(rate)
+	}
+	if err != nil {
+		return ErrNotRunning
+	}
+	workers, producers, rate = load.counts()
+	s.setCounts(workers, producers)
+	logrus.WithField("stage", id).Infof("Scaled to %d workers and %d producers sending %.0f requests by second", workers, producers, rate)
+	return nil
+}
+
+func (s *Stage) setLoad(load *load) {
+	s.mutex.Lock()
+	s.load = load
+	s.mutex.Unlock()
+}
+
+//setRequests keeps the channel between the producers and the workers to sample its backlog
+func (s *Stage) setRequests(requests chan request) {
+	s.mutex.Lock()
+	s.requests = requests
+	s.mutex.Unlock()
+}
+
+//Run starts the test and returns its result, it stops early when ctx is done or the stage is cancelled
+func (s *Stage) Run(ctx context.Context, id string) *StageResult {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.setID(id)
+	s.mutex.Lock()
+	s.startedAt = time.Now()
+	s.cancel = cancel
+	if s.cancelled {
+		cancel()
+	}
+	s.mutex.Unlock()
+	s.stopSampling = s.startSampling()
+
+	workload, err := NewWorkload(s.stageConfig.Workload)
+	if err != nil {
+		return s.finish(PhaseFailed, err)
+	}
+
+	//a search may run once for each max pool size, the data is only seeded the first time
+	var storeIds []string
+	for i, maxPool := range s.stageConfig.poolSizes(s.dbConfig.MaxPool) {
+		if ctx.Err() != nil {
+			break
+		}
+		storeIds, err = s.runPool(ctx, workload, maxPool, i == 0, storeIds)
+		if err != nil && ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			logrus.WithField("stage", id).Error(err)
+			return s.finish(PhaseFailed, err)
+		}
+	}
+
+	time.Sleep(1 * time.Second)
+
+	phase := PhaseFinished
+	if ctx.Err() != nil {
+		logrus.WithField("stage", id).Info("Stage cancelled")
+		phase = PhaseCancelled
+	}
+	result := s.finish(phase, nil)
+	logResult(result)
+
+	return result
+}
 
+//runPool runs the load on a new client with the given max pool size and closes it, the data is seeded
+//first when seed is set. Returns the ids of the seeded documents, storeIds otherwise
+func (s *Stage) runPool(ctx context.Context, workload *Workload, maxPool uint64, seed bool, storeIds []string) ([]string, error) {
+	repo, err := s.connect(ctx, maxPool)
+	if err != nil {
+		return storeIds, err
+	}
+	defer repo.Close()
+
+	if err := workload.bind(repo); err != nil {
+		return storeIds, err
+	}
+	if seed {
+		s.setPhase(PhaseSeeding, 0)
+		storeIds, err = ensureData(ctx, repo, s.stageConfig.CollectionSize, s.stageConfig.DocumentSize)
+		if err != nil {
+			return storeIds, err
+		}
+		s.cmdStats.Reset()
+	}
+
+	if ctx.Err() == nil {
+		repo.SetValidIds(storeIds)
+		s.runLoad(ctx, repo, workload, maxPool)
+	}
+	return storeIds, nil
+}
+
+//connect creates the repository of a run of the stage, every run shares the monitors
+func (s *Stage) connect(ctx context.Context, maxPool uint64) (repositories.TestRepository, error) {
 	config := &repositories.MongoDBConfiguration{
 		DbName:         s.dbConfig.DbName,
 		CollectionName: s.dbConfig.CollectionName,
 		ConnString:     s.dbConfig.ConnString,
 		MinPool:        s.dbConfig.MinPool,
-		MaxPool:        s.dbConfig.MaxPool,
+		MaxPool:        maxPool,
 		IdleTimeout:    s.dbConfig.IdleTimeout,
 		SocketTimeout:  s.dbConfig.SocketTimeout,
+		WriteConcern:   s.dbConfig.WriteConcern,
+		ReadPreference: s.dbConfig.ReadPreference,
+		ReadConcern:    s.dbConfig.ReadConcern,
 	}
-	repo, err := repositories.NewMongodbRepository(config, statsMonitor.MonitorFunc)
+	repo, err := repositories.NewMongodbRepository(ctx, config, repositories.Monitors{
+		Pool:    &event.PoolMonitor{Event: s.poolStats.MonitorFunc},
+		Command: s.cmdStats.Monitor(),
+		Server:  s.srvStats.Monitor(),
+	})
 	if err != nil {
-		logrus.Fatal(err)
+		return nil, err
 	}
 
-	storeIds, err := ensureData(repo, s.stageConfig.CollectionSize, s.stageConfig.DocumentSize)
-	if err != nil {
-		return
+	s.mutex.Lock()
+	if s.repository != nil {
+		s.previousQueries += s.repository.QueryCount()
 	}
+	s.repository = repo
+	s.mutex.Unlock()
 
-	repo.SetValidIds(storeIds)
-
-	eventChannel := make(chan struct{}, 1000)
-
-	wgP := &sync.WaitGroup{}
+	return repo, nil
+}
 
-	producers := addProducers(int(s.stageConfig.ProducersCount), eventChannel, int(s.stageConfig.MsgBySec), wgP)
+func (s *Stage) runLoad(ctx context.Context, repo repositories.TestRepository, workload *Workload, maxPool uint64) {
+	statsMonitor := s.poolStats
 
-	workers := addWorkers(int(s.stageConfig.WorkersCount), repo, eventChannel, s.stageConfig.QueryTimeoutMs, s.stageConfig.BatchSize)
+	load := newLoad(ctx, s.stageConfig, workload, s.recorder)
+	s.setRequests(load.eventChannel)
+	load.start(int(s.stageConfig.ProducersCount), int(s.stageConfig.WorkersCount), s.stageConfig.initialRate())
+	s.setLoad(load)
 
-	intLoad := int(s.stageConfig.IncrementLoad)
-	intTimeToSleep := int(s.stageConfig.TimeToSleepSecs)
-	for n := 0; n < intLoad; n++ {
-		logrus.Printf("Waiting %d seconds to add %d workers. Current count: %d",
-			s.stageConfig.TimeToSleepSecs, s.stageConfig.WorkersToAdd, len(workers))
-		for i := 0; i < intTimeToSleep; i++ {
-			logrus.WithField("executed", repo.QueryCount()).Infof("%v", statsMonitor)
-			time.Sleep(1 * time.Second)
-		}
-		workers = append(workers, addWorkers(int(s.stageConfig.WorkersToAdd), repo, eventChannel, s.stageConfig.QueryTimeoutMs, s.stageConfig.BatchSize)...)
-		logrus.Printf("%d workers added. Using %d in total", s.stageConfig.WorkersToAdd, len(workers))
+	if s.stageConfig.Search != nil {
+		s.runSearch(ctx, repo, load, maxPool)
+	} else {
+		s.runProfile(ctx, repo, load, s.stageConfig.profile())
 	}
 
-	logrus.Printf("Waiting %d seconds to finish", s.stageConfig.TimeToFinishSecs)
-	intTimeToFinish := int(s.stageConfig.TimeToFinishSecs)
-	for i := 0; i < intTimeToFinish; i++ {
-		logrus.WithField("executed", repo.QueryCount()).Infof("%+v", statsMonitor)
-		time.Sleep(1 * time.Second)
-	}
+	s.setLoad(nil)
+	load.stopProducers()
+	workers, _, _ := load.counts()
+	s.setCounts(workers, 0)
+	logrus.Println("Producers stopped.")
 
-	for _, producer := range producers {
-		producer.stop()
+	if ctx.Err() == nil {
+		s.startStep(PhaseDraining, s.stepNumber()+1, "", workers, 0)
 	}
-	wgP.Wait()
-	logrus.Println("Producers stopped.")
 
-	for len(eventChannel) > 0 {
+	for load.queued() > 0 && ctx.Err() == nil {
 		logrus.WithField("executed", repo.QueryCount()).Infof("%+v", statsMonitor)
-		time.Sleep(1 * time.Second)
+		sleep(ctx, 1*time.Second)
 	}
 
-	repo.Close()
-
-	time.Sleep(1 * time.Second)
-
-	logrus.Printf("")
-	logrus.Printf("--------------------------------------------------------------------------------------------------------------")
-	logrus.Printf("Final stats: %+v", statsMonitor)
-	logrus.Printf("--------------------------------------------------------------------------------------------------------------")
-	logrus.Printf("")
+	load.stop()
+	s.setRequests(nil)
+	s.setCounts(0, 0)
+	logrus.Println("Workers stopped.")
+}
 
-	logrus.Printf("************************************")
-	logrus.Printf("Total query count: %d", repo.QueryCount())
-	logrus.Printf("Total query timeouts: %d", timeouts)
-	logrus.Printf("Timeout percentage: %s", TimeoutPercentage(repo.QueryCount()))
-	logrus.Printf("************************************")
+//sleep waits for the given duration or until ctx is done
+func sleep(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
 }
 
 //TimeoutPercentage calculates the percentag and returns a string
-func TimeoutPercentage(queryCount int64) string {
+func TimeoutPercentage(timeouts int64, queryCount int64) string {
+	if queryCount == 0 {
+		return "0.00%"
+	}
 	timeoutPercentage := 100 * float64(timeouts) / float64(queryCount)
 
 	timeoutsString := fmt.Sprintf("%.2f", timeoutPercentage)
@@ -142,89 +364,71 @@ func TimeoutPercentage(queryCount int64) string {
 	return timeoutsString
 }
 
-func addWorkers(
-	workersCount int,
-	repo repositories.TestRepository,
-	evChan chan struct{},
-	timeout uint,
-	batchSize int32,
-) []*consumer {
-	var consumers []*consumer
-	for i := 0; i < workersCount; i++ {
-		consumer := &consumer{
-			repository:   repo,
-			eventChannel: evChan,
-			timeout:      timeout,
-			batchSize:    batchSize,
-		}
-		consumers = append(consumers, consumer)
-		go consumer.start()
-	}
-	return consumers
+type consumer struct {
+	workload      *Workload
+	params        OperationParams
+	lateThreshold time.Duration
+	recorder      *recorder
+	eventChannel  <-chan request
+	wg            *sync.WaitGroup
+	done          chan struct{}
 }
 
-func addProducers(producersCount int, eventChannel chan struct{}, msgBySec int, wg *sync.WaitGroup) []*producer {
-	var producers []*producer
-
-	wg.Add(producersCount)
-
-	for i := 0; i < producersCount; i++ {
-		producer := &producer{
-			eventChannel: eventChannel,
-			wg:           wg,
+func (c *consumer) start(ctx context.Context) {
+	defer c.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.done:
+			return
+		case next, ok := <-c.eventChannel:
+			if !ok {
+				return
+			}
+			c.execute(ctx, next)
 		}
-		producers = append(producers, producer)
-
-		go producer.start(time.Duration(1000/msgBySec) * time.Millisecond)
 	}
-
-	return producers
 }
 
-type producer struct {
-	eventChannel chan<- struct{}
-	tm           *time.Ticker
-	wg           *sync.WaitGroup
+//stop makes the worker return once its current request is done
+func (c *consumer) stop() {
+	close(c.done)
 }
 
-func (p *producer) start(sendEvery time.Duration) {
-	p.tm = time.NewTicker(sendEvery)
-	for range p.tm.C {
-		p.eventChannel <- struct{}{}
+func (c *consumer) execute(ctx context.Context, next request) {
+	var queueWait time.Duration
+	if !next.intended.IsZero() {
+		queueWait = time.Since(next.intended)
 	}
-}
 
-func (p *producer) stop() {
-	p.tm.Stop()
-	time.Sleep(100 * time.Millisecond)
-	p.wg.Done()
-}
-
-type consumer struct {
-	repository   repositories.TestRepository
-	timeout      uint
-	batchSize    int32
-	eventChannel <-chan struct{}
-}
-
-func (c *consumer) start() {
-
-	for range c.eventChannel {
-		size := rand.Intn(400-100) + 100 //pseudo random it's ok
+	entry := c.workload.next()
+	params := c.params
+	params.Size = entry.size
 
-		_, executionTime, err := c.repository.GetStores(uint(size), c.timeout, c.batchSize)
-		if err != nil {
-			timeouts = timeouts + 1
-			logrus.WithField("Execution time", executionTime).Errorf("%+v", err)
-		}
+	executionTime, err := entry.operation.Execute(ctx, entry.repository, params)
+	if ctx.Err() != nil {
+		return
+	}
+	category := repositories.ClassifyError(err)
+	c.recorder.record(outcome{
+		operation:     entry.name,
+		executionTime: executionTime,
+		queueWait:     queueWait,
+		late:          queueWait > c.lateThreshold,
+		category:      category,
+	})
+	if err != nil {
+		logrus.WithField("Execution time", executionTime).WithField("operation", entry.name).WithField("category", category).Errorf("%+v", err)
 	}
 }
 
-func ensureData(repository repositories.TestRepository, collectionSize int, documentSize int) ([]string, error) {
+func ensureData(ctx context.Context, repository repositories.TestRepository, collectionSize int, documentSize int) ([]string, error) {
 
 	logrus.Info("Creating data for the test...")
 
-	count, err := repository.Count()
+	count, err := repository.Count(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -236,6 +440,9 @@ func ensureData(repository repositories.TestRepository, collectionSize int, docu
 	var storeIds []string
 	var data []repositories.Store
 	for i := 0; i < collectionSize; i++ {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		storeID := GenerateID()
 		storeIds = append(storeIds, storeID)
 		name := "name: " + strconv.Itoa(i)
@@ -258,7 +465,7 @@ func ensureData(repository repositories.TestRepository, collectionSize int, docu
 	}
 	logrus.Infof("%d Documents created.", collectionSize)
 	logrus.Infof("Inserting data into the database...")
-	err = repository.Insert(data)
+	err = repository.Insert(ctx, data)
 	logrus.Infof("Data inserted.")
 
 	return storeIds, err
@@ -0,0 +1,141 @@
+package stage
+
+import (
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/stats"
+)
+
+//Phase of a stage execution
+type Phase string
+
+//Phases a stage goes through while running
+const (
+	PhasePending   Phase = "pending"
+	PhaseQueued    Phase = "queued"
+	PhaseSeeding   Phase = "seeding"
+	PhaseRamping   Phase = "ramping"
+	PhaseHolding   Phase = "holding"
+	PhaseDraining  Phase = "draining"
+	PhaseSearching Phase = "searching"
+	//PhaseRunning is the phase of a suite while its stages run
+	PhaseRunning   Phase = "running"
+	PhaseFinished  Phase = "finished"
+	PhaseFailed    Phase = "failed"
+	PhaseCancelled Phase = "cancelled"
+)
+
+//StagePhases are the phases of a stage, in the order they happen
+var StagePhases = []Phase{
+	PhasePending, PhaseQueued, PhaseSeeding, PhaseRamping, PhaseHolding, PhaseSearching, PhaseDraining,
+	PhaseFinished, PhaseFailed, PhaseCancelled,
+}
+
+//Status struct
+type Status struct {
+	ID                string             `json:"id"`
+	Phase             Phase              `json:"phase"`
+	QueuePosition     int                `json:"queue_position,omitempty"`
+	Step              int                `json:"step"`
+	Steps             int                `json:"steps"`
+	Workers           int                `json:"workers"`
+	Producers         int                `json:"producers"`
+	Rate              float64            `json:"rate"`
+	QueryCount        int64              `json:"query_count"`
+	Completed         int64              `json:"completed"`
+	Timeouts          int64              `json:"timeouts"`
+	TimeoutPercentage string             `json:"timeout_percentage"`
+	Errors            int64              `json:"errors"`
+	Dropped           int64              `json:"dropped"`
+	Late              int64              `json:"late"`
+	ErrorBreakdown    map[string]int64   `json:"error_breakdown"`
+	PoolStats         stats.PoolSnapshot `json:"pool_stats"`
+	StartedAt         *time.Time         `json:"started_at,omitempty"`
+	FinishedAt        *time.Time         `json:"finished_at,omitempty"`
+	Error             string             `json:"error,omitempty"`
+}
+
+//Status returns the current state of the stage
+func (s *Stage) Status() Status {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	status := Status{
+		ID:            s.id,
+		Phase:         s.phase,
+		Step:          s.step,
+		QueuePosition: s.queuePosition,
+		Steps:         s.stageConfig.steps(),
+		Workers:       s.workers,
+		Producers:     s.producers,
+		Completed:     s.recorder.completed(),
+		Timeouts:      s.Timeouts(),
+		PoolStats:     s.poolStats.Snapshot(),
+	}
+	if s.load != nil {
+		_, _, status.Rate = s.load.counts()
+	}
+	status.QueryCount = s.queryCount()
+	status.TimeoutPercentage = TimeoutPercentage(status.Timeouts, status.Completed)
+	status.Errors, status.ErrorBreakdown = s.recorder.errors()
+	status.Dropped, status.Late = s.recorder.dropped()
+	if !s.startedAt.IsZero() {
+		startedAt := s.startedAt
+		status.StartedAt = &startedAt
+	}
+	if !s.finishedAt.IsZero() {
+		finishedAt := s.finishedAt
+		status.FinishedAt = &finishedAt
+	}
+	if s.err != nil {
+		status.Error = s.err.Error()
+	}
+
+	return status
+}
+
+//Latency returns a copy of the latency histogram of the whole stage
+func (s *Stage) Latency() *stats.Histogram {
+	return s.recorder.latency()
+}
+
+//Commands returns the command monitoring counters of the stage
+func (s *Stage) Commands() stats.CommandSnapshot {
+	return s.cmdStats.Snapshot()
+}
+
+//Topology returns the server monitoring counters of the stage
+func (s *Stage) Topology() stats.ServerSnapshot {
+	return s.srvStats.Snapshot()
+}
+
+func (s *Stage) setPhase(phase Phase, step int) {
+	s.mutex.Lock()
+	s.phase = phase
+	s.step = step
+	s.publishPhase()
+	s.mutex.Unlock()
+}
+
+//stepNumber returns the current step
+func (s *Stage) stepNumber() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.step
+}
+
+//queryCount returns the queries sent by every repository of the stage, s.mutex must be held
+func (s *Stage) queryCount() int64 {
+	count := s.previousQueries
+	if s.repository != nil {
+		count += s.repository.QueryCount()
+	}
+	return count
+}
+
+func (s *Stage) setCounts(workers int, producers int) {
+	s.mutex.Lock()
+	s.workers = workers
+	s.producers = producers
+	s.mutex.Unlock()
+}
@@ -0,0 +1,103 @@
+package stage
+
+import "time"
+
+//streamBuffer is the number of events kept for a subscriber that is slow to read them, the newer ones are dropped
+const streamBuffer = 64
+
+//Stream events
+const (
+	//EventSample carries a Sample, sent every second while the stage runs
+	EventSample = "sample"
+	//EventPhase carries a PhaseChange, sent when the stage enters a new phase or step or moves in the queue
+	EventPhase = "phase"
+)
+
+//Event is pushed to the subscribers of a stage
+type Event struct {
+	Name string
+	Data interface{}
+}
+
+//PhaseChange is the data of a phase event
+type PhaseChange struct {
+	Time          time.Time `json:"time"`
+	Phase         Phase     `json:"phase"`
+	Step          int       `json:"step"`
+	Name          string    `json:"name,omitempty"`
+	QueuePosition int       `json:"queue_position,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+//Subscribe returns a channel with the events of the stage, starting with its current phase, the channel
+//is closed once the stage is done or the returned function is called
+func (s *Stage) Subscribe() (<-chan Event, func()) {
+	events := make(chan Event, streamBuffer)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events <- Event{Name: EventPhase, Data: s.phaseChange()}
+	if s.result != nil {
+		close(events)
+		return events, func() {}
+	}
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan Event]bool)
+	}
+	s.subscribers[events] = true
+
+	return events, func() {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.subscribers[events] {
+			delete(s.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+//publish sends an event to every subscriber without waiting for them, s.mutex must be held
+func (s *Stage) publish(name string, data interface{}) {
+	for events := range s.subscribers {
+		select {
+		case events <- Event{Name: name, Data: data}:
+		default:
+		}
+	}
+}
+
+//publishPhase sends a phase event if the phase, the step or the queue position changed since the last one,
+//s.mutex must be held
+func (s *Stage) publishPhase() {
+	if s.phase == s.publishedPhase && s.step == s.publishedStep && s.queuePosition == s.publishedQueue {
+		return
+	}
+	s.publishedPhase, s.publishedStep, s.publishedQueue = s.phase, s.step, s.queuePosition
+	s.publish(EventPhase, s.phaseChange())
+}
+
+//closeSubscribers ends the stream of every subscriber, s.mutex must be held
+func (s *Stage) closeSubscribers() {
+	for events := range s.subscribers {
+		close(events)
+	}
+	s.subscribers = nil
+}
+
+//phaseChange describes the current phase, s.mutex must be held
+func (s *Stage) phaseChange() PhaseChange {
+	change := PhaseChange{
+		Time:          time.Now(),
+		Phase:         s.phase,
+		Step:          s.step,
+		QueuePosition: s.queuePosition,
+	}
+	if s.currentStep != nil && s.currentStep.Step == s.step {
+		change.Name = s.currentStep.Name
+	}
+	if s.err != nil {
+		change.Error = s.err.Error()
+	}
+	return change
+}
@@ -0,0 +1,264 @@
+package stage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//SuiteStage is a named stage of a suite, registered under its id before the suite starts
+type SuiteStage struct {
+	Name  string
+	ID    string
+	Stage *Stage
+}
+
+//Suite runs its stages one after the other
+type Suite struct {
+	id         string
+	name       string
+	stages     []SuiteStage
+	phase      Phase
+	startedAt  time.Time
+	finishedAt time.Time
+	scheduler  *Scheduler
+	cancel     context.CancelFunc
+	cancelled  bool
+	mutex      sync.RWMutex
+}
+
+//SuiteReport is the combined report of the stages of a suite
+type SuiteReport struct {
+	ID         string             `json:"id"`
+	Name       string             `json:"name"`
+	Phase      Phase              `json:"phase"`
+	Passed     bool               `json:"passed"`
+	StartedAt  *time.Time         `json:"started_at,omitempty"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Stages     []SuiteStageReport `json:"stages"`
+}
+
+//SuiteStageReport sums up a stage of the suite, the result is only there once the stage is done
+type SuiteStageReport struct {
+	Name            string       `json:"name"`
+	ID              string       `json:"id"`
+	Phase           Phase        `json:"phase"`
+	Passed          bool         `json:"passed"`
+	QueryCount      int64        `json:"query_count"`
+	Throughput      float64      `json:"throughput"`
+	ErrorPercentage string       `json:"error_percentage"`
+	P99Ms           float64      `json:"p99_ms"`
+	Verdict         *Verdict     `json:"verdict,omitempty"`
+	Result          *StageResult `json:"result,omitempty"`
+}
+
+//NewSuite creates a pending suite
+func NewSuite(name string, stages []SuiteStage) *Suite {
+	return &Suite{
+		name:   name,
+		stages: stages,
+		phase:  PhasePending,
+	}
+}
+
+//Stages returns the stages of the suite, in running order
+func (s *Suite) Stages() []SuiteStage {
+	return s.stages
+}
+
+//Run executes the stages sequentially and returns the combined report, once cancelled the remaining
+//stages finish as cancelled without running. With a scheduler every stage is queued at once and
+//the other stages submitted to it may run in between, without one they run right away
+func (s *Suite) Run(ctx context.Context, id string, scheduler *Scheduler) SuiteReport {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.mutex.Lock()
+	s.id = id
+	s.phase = PhaseRunning
+	s.startedAt = time.Now()
+	s.cancel = cancel
+	s.scheduler = scheduler
+	if s.cancelled {
+		cancel()
+	}
+	s.mutex.Unlock()
+
+	if scheduler != nil {
+		for _, suiteStage := range s.stages {
+			scheduler.Submit(suiteStage.ID, suiteStage.Stage)
+		}
+	}
+	for i, suiteStage := range s.stages {
+		if ctx.Err() != nil {
+			suiteStage.Stage.Cancel()
+		}
+		if scheduler != nil {
+			<-suiteStage.Stage.Done()
+			continue
+		}
+		logrus.WithField("suite", id).Printf("Running stage %d of %d: %s (%s)", i+1, len(s.stages), suiteStage.Name, suiteStage.ID)
+		suiteStage.Stage.Run(ctx, suiteStage.ID)
+	}
+
+	s.mutex.Lock()
+	s.phase = PhaseFinished
+	if s.cancelled {
+		s.phase = PhaseCancelled
+	}
+	s.finishedAt = time.Now()
+	s.mutex.Unlock()
+
+	report := s.Report()
+	logSuite(report)
+	return report
+}
+
+//Cancel stops the running stage of the suite and skips the rest, returns false if it was already done
+func (s *Suite) Cancel() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.phase == PhaseFinished || s.phase == PhaseCancelled {
+		return false
+	}
+	s.cancelled = true
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for _, suiteStage := range s.stages {
+		if s.scheduler == nil || !s.scheduler.Remove(suiteStage.ID) {
+			suiteStage.Stage.Cancel()
+		}
+	}
+	return true
+}
+
+//doneBefore tells if the suite is done since before the given time
+func (s *Suite) doneBefore(before time.Time) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return !s.finishedAt.IsZero() && s.finishedAt.Before(before)
+}
+
+//Report returns the combined report of the suite so far
+func (s *Suite) Report() SuiteReport {
+	s.mutex.RLock()
+	report := SuiteReport{
+		ID:    s.id,
+		Name:  s.name,
+		Phase: s.phase,
+	}
+	if !s.startedAt.IsZero() {
+		startedAt := s.startedAt
+		report.StartedAt = &startedAt
+	}
+	if !s.finishedAt.IsZero() {
+		finishedAt := s.finishedAt
+		report.FinishedAt = &finishedAt
+	}
+	s.mutex.RUnlock()
+
+	report.Passed = report.Phase == PhaseFinished
+	for _, suiteStage := range s.stages {
+		stageReport := SuiteStageReport{Name: suiteStage.Name, ID: suiteStage.ID}
+		if result, ok := suiteStage.Stage.Result(); ok {
+			stageReport.Phase = result.Phase
+			stageReport.Passed = result.Phase == PhaseFinished && (result.Verdict == nil || result.Verdict.Passed)
+			stageReport.QueryCount = result.QueryCount
+			stageReport.Throughput = result.Throughput
+			stageReport.ErrorPercentage = result.ErrorPercentage
+			stageReport.P99Ms = result.Latency.P99Ms
+			stageReport.Verdict = result.Verdict
+			stageReport.Result = result
+		} else {
+			status := suiteStage.Stage.Status()
+			stageReport.Phase = status.Phase
+			stageReport.QueryCount = status.QueryCount
+		}
+		report.Passed = report.Passed && stageReport.Passed
+		report.Stages = append(report.Stages, stageReport)
+	}
+	return report
+}
+
+func logSuite(report SuiteReport) {
+	logrus.Printf("************************************")
+	logrus.Printf("Suite %s %s: passed=%t", report.Name, report.Phase, report.Passed)
+	for _, stageReport := range report.Stages {
+		logrus.Printf("  %s (%s) %s: passed=%t, queries=%d, throughput=%.1f, errors=%s, p99=%.2fms",
+			stageReport.Name, stageReport.ID, stageReport.Phase, stageReport.Passed, stageReport.QueryCount,
+			stageReport.Throughput, stageReport.ErrorPercentage, stageReport.P99Ms)
+	}
+	logrus.Printf("************************************")
+}
+
+//SuiteRegistry keeps track of the suites started by the server
+type SuiteRegistry struct {
+	suites map[string]*Suite
+	ids    []string
+	mutex  sync.RWMutex
+}
+
+//NewSuiteRegistry creates an empty registry
+func NewSuiteRegistry() *SuiteRegistry {
+	return &SuiteRegistry{
+		suites: make(map[string]*Suite),
+	}
+}
+
+//Add registers a suite under the given id
+func (r *SuiteRegistry) Add(id string, suite *Suite) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.suites[id]; !ok {
+		r.ids = append(r.ids, id)
+	}
+	suite.mutex.Lock()
+	suite.id = id
+	suite.mutex.Unlock()
+	r.suites[id] = suite
+}
+
+//Get returns the suite registered under the given id
+func (r *SuiteRegistry) Get(id string) (*Suite, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	suite, ok := r.suites[id]
+	return suite, ok
+}
+
+//Prune removes the suites that are done since before the given time and returns their ids
+func (r *SuiteRegistry) Prune(doneBefore time.Time) []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var pruned []string
+	ids := r.ids[:0]
+	for _, id := range r.ids {
+		if r.suites[id].doneBefore(doneBefore) {
+			delete(r.suites, id)
+			pruned = append(pruned, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	r.ids = ids
+	return pruned
+}
+
+//List returns the report of every registered suite, in creation order
+func (r *SuiteRegistry) List() []SuiteReport {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make([]SuiteReport, 0, len(r.ids))
+	for _, id := range r.ids {
+		result = append(result, r.suites[id].Report())
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package stage
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//sampleInterval is the time between two samples of the time series
+const sampleInterval = time.Second
+
+//Sample holds the counters of the stage at a second of its run, the counters are cumulative and the
+//throughput and the latency are the ones of the queries completed since the previous sample
+type Sample struct {
+	Time           time.Time        `json:"time"`
+	ElapsedSecs    float64          `json:"elapsed_secs"`
+	Phase          Phase            `json:"phase"`
+	Step           int              `json:"step"`
+	Workers        int              `json:"workers"`
+	Producers      int              `json:"producers"`
+	Rate           float64          `json:"rate"`
+	Started        int64            `json:"started"`
+	Completed      int64            `json:"completed"`
+	Throughput     float64          `json:"throughput"`
+	P50Ms          float64          `json:"p50_ms"`
+	P90Ms          float64          `json:"p90_ms"`
+	P99Ms          float64          `json:"p99_ms"`
+	Errors         int64            `json:"errors"`
+	Timeouts       int64            `json:"timeouts"`
+	ErrorBreakdown map[string]int64 `json:"error_breakdown"`
+	Dropped        int64            `json:"dropped"`
+	Late           int64            `json:"late"`
+	InUse          int64            `json:"in_use"`
+	Created        int64            `json:"created"`
+	Closed         int64            `json:"closed"`
+	GetsFailed     int64            `json:"gets_failed"`
+	Backlog        int              `json:"backlog"`
+	Goroutines     int              `json:"goroutines"`
+}
+
+//startSampling adds a sample to the time series every second until the returned function is called,
+//which takes a last sample
+func (s *Stage) startSampling() func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(sampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.addSample()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+		s.addSample()
+	}
+}
+
+func (s *Stage) addSample() {
+	now := time.Now()
+	counters, latency := s.recorder.sample()
+	pool := s.poolStats.Snapshot()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sample := Sample{
+		Time:           now,
+		ElapsedSecs:    now.Sub(s.startedAt).Seconds(),
+		Phase:          s.phase,
+		Step:           s.step,
+		Workers:        s.workers,
+		Producers:      s.producers,
+		Started:        s.queryCount(),
+		Completed:      counters.queries,
+		P50Ms:          latency.P50Ms,
+		P90Ms:          latency.P90Ms,
+		P99Ms:          latency.P99Ms,
+		Errors:         counters.errors,
+		Timeouts:       counters.timeouts,
+		ErrorBreakdown: counters.kinds,
+		Dropped:        counters.dropped,
+		Late:           counters.late,
+		InUse:          pool.InUse,
+		Created:        pool.Created,
+		Closed:         pool.Closed,
+		GetsFailed:     pool.GetsFailed,
+		Backlog:        len(s.requests),
+		Goroutines:     runtime.NumGoroutine(),
+	}
+	if s.load != nil {
+		_, _, sample.Rate = s.load.counts()
+	}
+	previous := Sample{Time: s.startedAt}
+	if len(s.timeseries) > 0 {
+		previous = s.timeseries[len(s.timeseries)-1]
+	}
+	sample.Throughput = throughput(sample.Completed-previous.Completed, sample.Time.Sub(previous.Time))
+
+	s.timeseries = append(s.timeseries, sample)
+	s.publish(EventSample, sample)
+}
+
+//TimeSeries returns the samples taken so far
+func (s *Stage) TimeSeries() []Sample {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]Sample{}, s.timeseries...)
+}
+
+//TimeSeriesCSV lays the samples out as CSV rows with a header, the errors get a column by category
+func TimeSeriesCSV(samples []Sample) [][]string {
+	categories := make(map[string]bool)
+	for _, sample := range samples {
+		for category := range sample.ErrorBreakdown {
+			categories[category] = true
+		}
+	}
+	var categoryNames []string
+	for category := range categories {
+		categoryNames = append(categoryNames, category)
+	}
+	sort.Strings(categoryNames)
+
+	header := []string{"time", "elapsed_secs", "phase", "step", "workers", "producers", "rate", "started", "completed",
+		"throughput", "p50_ms", "p90_ms", "p99_ms", "errors", "timeouts", "dropped", "late", "in_use", "created",
+		"closed", "gets_failed", "backlog", "goroutines"}
+	for _, category := range categoryNames {
+		header = append(header, "errors_"+strings.ReplaceAll(category, " ", "_"))
+	}
+
+	rows := [][]string{header}
+	for _, sample := range samples {
+		row := []string{
+			sample.Time.Format(time.RFC3339Nano),
+			formatFloat(sample.ElapsedSecs),
+			string(sample.Phase),
+			strconv.Itoa(sample.Step),
+			strconv.Itoa(sample.Workers),
+			strconv.Itoa(sample.Producers),
+			formatFloat(sample.Rate),
+			strconv.FormatInt(sample.Started, 10),
+			strconv.FormatInt(sample.Completed, 10),
+			formatFloat(sample.Throughput),
+			formatFloat(sample.P50Ms),
+			formatFloat(sample.P90Ms),
+			formatFloat(sample.P99Ms),
+			strconv.FormatInt(sample.Errors, 10),
+			strconv.FormatInt(sample.Timeouts, 10),
+			strconv.FormatInt(sample.Dropped, 10),
+			strconv.FormatInt(sample.Late, 10),
+			strconv.FormatInt(sample.InUse, 10),
+			strconv.FormatInt(sample.Created, 10),
+			strconv.FormatInt(sample.Closed, 10),
+			strconv.FormatInt(sample.GetsFailed, 10),
+			strconv.Itoa(sample.Backlog),
+			strconv.Itoa(sample.Goroutines),
+		}
+		for _, category := range categoryNames {
+			row = append(row, strconv.FormatInt(sample.ErrorBreakdown[category], 10))
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
@@ -0,0 +1,267 @@
+package stage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+//Built in operations
+const (
+	OperationFindIn      = "find_in"
+	OperationPointLookup = "point_lookup"
+	OperationFindOne     = "find_one"
+	OperationRangeScan   = "range_scan"
+	OperationAggregate   = "aggregate"
+	OperationCount       = "count"
+	OperationDistinct    = "distinct"
+	OperationUpdate      = "update"
+	OperationIncrement   = "increment"
+	OperationReplace     = "replace"
+	OperationBulkWrite   = "bulk_write"
+	OperationUpsert      = "upsert"
+	OperationDelete      = "delete"
+	OperationInsert      = "insert"
+)
+
+const (
+	defaultScanLimit = 100
+	defaultBulkSize  = 10
+)
+
+//Operation is a kind of request the workers send to the database, it returns the execution time in ms
+type Operation interface {
+	Execute(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error)
+}
+
+//OperationFunc adapts a function to an Operation
+type OperationFunc func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error)
+
+//Execute calls f
+func (f OperationFunc) Execute(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+	return f(ctx, repository, params)
+}
+
+//OperationParams are passed to every execution of an operation
+type OperationParams struct {
+	TimeoutMs    uint
+	BatchSize    int32
+	DocumentSize int
+	//Size is the number of ids for the $in operations, the limit of the range scans or the stores of
+	//the bulk writes, 0 for the default
+	Size uint
+}
+
+//WorkloadItem is an operation and its relative weight in the workload, the read options override the ones of the client
+type WorkloadItem struct {
+	Operation      string          `json:"operation"`
+	Weight         uint            `json:"weight"`
+	Size           uint            `json:"size,omitempty"`
+	ReadPreference *ReadPreference `json:"read_preference,omitempty"`
+	ReadConcern    string          `json:"read_concern,omitempty"`
+}
+
+//ReadPreference of the client or of a single operation
+type ReadPreference struct {
+	Mode                string              `json:"mode"`
+	TagSets             []map[string]string `json:"tag_sets,omitempty"`
+	MaxStalenessSeconds uint                `json:"max_staleness_seconds,omitempty"`
+}
+
+//Configuration returns the repository configuration of the read preference, nil for nil
+func (r *ReadPreference) Configuration() *repositories.ReadPreferenceConfiguration {
+	if r == nil {
+		return nil
+	}
+	return &repositories.ReadPreferenceConfiguration{
+		Mode:         r.Mode,
+		TagSets:      r.TagSets,
+		MaxStaleness: time.Duration(r.MaxStalenessSeconds) * time.Second,
+	}
+}
+
+var operations = map[string]Operation{
+	OperationFindIn: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		_, executionTime, err := repository.GetStores(ctx, inSize(params), params.TimeoutMs, params.BatchSize)
+		return executionTime, err
+	}),
+	OperationPointLookup: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.FindStore(ctx, params.TimeoutMs)
+	}),
+	OperationFindOne: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.FindOneStore(ctx, params.TimeoutMs)
+	}),
+	OperationRangeScan: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		limit := params.Size
+		if limit == 0 {
+			limit = defaultScanLimit
+		}
+		return repository.ScanStores(ctx, limit, params.TimeoutMs, params.BatchSize)
+	}),
+	OperationAggregate: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.AggregateStores(ctx, inSize(params), params.TimeoutMs, params.BatchSize)
+	}),
+	OperationCount: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.CountStores(ctx, inSize(params), params.TimeoutMs)
+	}),
+	OperationDistinct: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.DistinctNames(ctx, inSize(params), params.TimeoutMs)
+	}),
+	OperationUpdate: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.UpdateStore(ctx, "name: "+strconv.Itoa(rand.Int()))
+	}),
+	OperationIncrement: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.IncrementStore(ctx)
+	}),
+	OperationReplace: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.ReplaceStore(ctx, newStore(params))
+	}),
+	OperationBulkWrite: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		size := params.Size
+		if size == 0 {
+			size = defaultBulkSize
+		}
+		stores := make([]repositories.Store, 0, size)
+		for i := uint(0); i < size; i++ {
+			stores = append(stores, newStore(params))
+		}
+		return repository.BulkWriteStores(ctx, stores)
+	}),
+	OperationUpsert: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.UpsertStore(ctx, newStore(params))
+	}),
+	OperationDelete: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.DeleteStore(ctx)
+	}),
+	OperationInsert: OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return repository.InsertStore(ctx, newStore(params))
+	}),
+}
+
+//operationsMutex guards operations, the workloads keep the operation they were built with
+var operationsMutex sync.RWMutex
+
+//RegisterOperation makes a new operation available to the workloads built after it, replacing the one with the same name
+func RegisterOperation(name string, operation Operation) {
+	operationsMutex.Lock()
+	operations[name] = operation
+	operationsMutex.Unlock()
+}
+
+//OperationNames returns the operations available to the workloads, sorted
+func OperationNames() []string {
+	operationsMutex.RLock()
+	defer operationsMutex.RUnlock()
+
+	var names []string
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Workload picks the operation to execute according to the weights
+type Workload struct {
+	entries     []workloadEntry
+	totalWeight uint
+}
+
+type workloadEntry struct {
+	name           string
+	operation      Operation
+	weight         uint
+	size           uint
+	readPreference *ReadPreference
+	readConcern    string
+	repository     repositories.TestRepository
+}
+
+//NewWorkload validates the items and builds the workload, without items every request is a find_in
+func NewWorkload(items []WorkloadItem) (*Workload, error) {
+	if len(items) == 0 {
+		items = []WorkloadItem{{Operation: OperationFindIn, Weight: 1}}
+	}
+
+	workload := &Workload{}
+	for _, item := range items {
+		operationsMutex.RLock()
+		operation, ok := operations[item.Operation]
+		operationsMutex.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown operation '%s', expected one of %v", item.Operation, OperationNames())
+		}
+		if _, err := item.ReadPreference.Configuration().ReadPref(); err != nil {
+			return nil, fmt.Errorf("operation '%s': %v", item.Operation, err)
+		}
+		if _, err := repositories.NewReadConcern(item.ReadConcern); err != nil {
+			return nil, fmt.Errorf("operation '%s': %v", item.Operation, err)
+		}
+		if item.Weight == 0 {
+			continue
+		}
+		workload.entries = append(workload.entries, workloadEntry{
+			name:           item.Operation,
+			operation:      operation,
+			weight:         item.Weight,
+			size:           item.Size,
+			readPreference: item.ReadPreference,
+			readConcern:    item.ReadConcern,
+		})
+		workload.totalWeight += item.Weight
+	}
+	if workload.totalWeight == 0 {
+		return nil, fmt.Errorf("the workload needs at least one operation with weight")
+	}
+
+	return workload, nil
+}
+
+//bind sets the repository used by every operation, the ones with their own read options get a copy of it
+func (w *Workload) bind(repository repositories.TestRepository) error {
+	for i := range w.entries {
+		entry := &w.entries[i]
+		entry.repository = repository
+		if entry.readPreference == nil && entry.readConcern == "" {
+			continue
+		}
+		withReadOptions, err := repository.WithReadOptions(entry.readPreference.Configuration(), entry.readConcern)
+		if err != nil {
+			return err
+		}
+		entry.repository = withReadOptions
+	}
+	return nil
+}
+
+func (w *Workload) next() workloadEntry {
+	target := uint(rand.Intn(int(w.totalWeight)))
+	for _, entry := range w.entries {
+		if target < entry.weight {
+			return entry
+		}
+		target -= entry.weight
+	}
+	return w.entries[len(w.entries)-1]
+}
+
+func inSize(params OperationParams) uint {
+	if params.Size != 0 {
+		return params.Size
+	}
+	return uint(rand.Intn(400-100) + 100) //pseudo random it's ok
+}
+
+func newStore(params OperationParams) repositories.Store {
+	return repositories.Store{
+		StoreId:   GenerateID(),
+		Name:      "name: " + strconv.Itoa(rand.Int()),
+		HugeValue: GenerateString(params.DocumentSize),
+	}
+}
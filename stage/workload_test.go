@@ -0,0 +1,48 @@
+package stage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/andresneva/mongo_driver_test/repositories"
+)
+
+func TestRegisterOperationWhileBuildingWorkloads(t *testing.T) {
+	noop := OperationFunc(func(ctx context.Context, repository repositories.TestRepository, params OperationParams) (float64, error) {
+		return 0, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("test_noop_%d", i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterOperation(name, noop)
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := NewWorkload([]WorkloadItem{{Operation: OperationFindIn, Weight: 1}}); err != nil {
+				t.Error(err)
+			}
+			OperationNames()
+		}()
+	}
+	wg.Wait()
+
+	workload, err := NewWorkload([]WorkloadItem{{Operation: "test_noop_0", Weight: 1}})
+	if err != nil {
+		t.Fatalf("registered operation: %v", err)
+	}
+	if len(workload.entries) != 1 || workload.entries[0].name != "test_noop_0" {
+		t.Errorf("got %+v, want test_noop_0", workload.entries)
+	}
+}
+
+func TestNewWorkloadUnknownOperation(t *testing.T) {
+	if _, err := NewWorkload([]WorkloadItem{{Operation: "missing", Weight: 1}}); err == nil {
+		t.Error("expected an error")
+	}
+}
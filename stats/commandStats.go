@@ -0,0 +1,176 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var failureCodeRegexp = regexp.MustCompile(`^\((\w+)\)`)
+
+//CommandStats collects the command monitoring events by command name
+type CommandStats struct {
+	commands map[string]*commandCounters
+	failures map[string]int64
+	mutex    sync.Mutex
+}
+
+type commandCounters struct {
+	started   int64
+	succeeded int64
+	failed    int64
+	duration  *Histogram
+}
+
+//CommandSummary of a single command name
+type CommandSummary struct {
+	Started   int64          `json:"started"`
+	Succeeded int64          `json:"succeeded"`
+	Failed    int64          `json:"failed"`
+	Duration  LatencySummary `json:"duration"`
+	durations *Histogram
+}
+
+//CommandSnapshot is a point in time copy of the command counters
+type CommandSnapshot struct {
+	Commands map[string]CommandSummary `json:"commands"`
+	Failures map[string]int64          `json:"failures"`
+}
+
+//NewCommandStats creates an empty collector
+func NewCommandStats() *CommandStats {
+	return &CommandStats{
+		commands: make(map[string]*commandCounters),
+		failures: make(map[string]int64),
+	}
+}
+
+//Monitor returns the driver monitor feeding this collector
+func (c *CommandStats) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   c.Started,
+		Succeeded: c.Succeeded,
+		Failed:    c.Failed,
+	}
+}
+
+//Started counts a command sent to the server
+func (c *CommandStats) Started(_ context.Context, startedEvent *event.CommandStartedEvent) {
+	c.mutex.Lock()
+	c.counters(startedEvent.CommandName).started++
+	c.mutex.Unlock()
+}
+
+//Succeeded counts a successful command and records its round trip duration
+func (c *CommandStats) Succeeded(_ context.Context, succeededEvent *event.CommandSucceededEvent) {
+	c.mutex.Lock()
+	counters := c.counters(succeededEvent.CommandName)
+	counters.succeeded++
+	counters.duration.Record(time.Duration(succeededEvent.DurationNanos))
+	c.mutex.Unlock()
+}
+
+//Failed counts a failed command by failure code and records its round trip duration
+func (c *CommandStats) Failed(_ context.Context, failedEvent *event.CommandFailedEvent) {
+	c.mutex.Lock()
+	counters := c.counters(failedEvent.CommandName)
+	counters.failed++
+	counters.duration.Record(time.Duration(failedEvent.DurationNanos))
+	c.failures[failureCode(failedEvent.Failure)]++
+	c.mutex.Unlock()
+}
+
+//Reset discards every counter, used to leave the setup commands out of the stats
+func (c *CommandStats) Reset() {
+	c.mutex.Lock()
+	c.commands = make(map[string]*commandCounters)
+	c.failures = make(map[string]int64)
+	c.mutex.Unlock()
+}
+
+func (c *CommandStats) counters(commandName string) *commandCounters {
+	counters, ok := c.commands[commandName]
+	if !ok {
+		counters = &commandCounters{duration: NewHistogram()}
+		c.commands[commandName] = counters
+	}
+	return counters
+}
+
+//Snapshot returns a copy of the current counters, safe to be serialized
+func (c *CommandStats) Snapshot() CommandSnapshot {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	snapshot := CommandSnapshot{
+		Commands: make(map[string]CommandSummary, len(c.commands)),
+		Failures: make(map[string]int64, len(c.failures)),
+	}
+	for name, counters := range c.commands {
+		snapshot.Commands[name] = CommandSummary{
+			Started:   counters.started,
+			Succeeded: counters.succeeded,
+			Failed:    counters.failed,
+			Duration:  counters.duration.Summary(),
+			durations: counters.duration.Copy(),
+		}
+	}
+	for code, count := range c.failures {
+		snapshot.Failures[code] = count
+	}
+	return snapshot
+}
+
+//Durations returns the round trip histogram of the command
+func (c CommandSummary) Durations() *Histogram {
+	if c.durations == nil {
+		return NewHistogram()
+	}
+	return c.durations
+}
+
+//TotalDuration returns the time spent in round trips by every command, in milliseconds
+func (c CommandSnapshot) TotalDuration() float64 {
+	var total int64
+	for _, summary := range c.Commands {
+		total += summary.Durations().Sum()
+	}
+	return toMs(total)
+}
+
+//Names returns the command names, sorted
+func (c CommandSnapshot) Names() []string {
+	names := make([]string, 0, len(c.Commands))
+	for name := range c.Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c CommandSnapshot) String() string {
+	var parts []string
+	for _, name := range c.Names() {
+		summary := c.Commands[name]
+		parts = append(parts, fmt.Sprintf("%s={started=%d, succeeded=%d, failed=%d, p99=%.2fms}",
+			name, summary.Started, summary.Succeeded, summary.Failed, summary.Duration.P99Ms))
+	}
+	return fmt.Sprintf("{%s, failures=%v}", strings.Join(parts, ", "), c.Failures)
+}
+
+//failureCode extracts the server code name of a failure, "(MaxTimeMSExpired) operation exceeded time limit"
+func failureCode(failure string) string {
+	if match := failureCodeRegexp.FindStringSubmatch(failure); match != nil {
+		return match[1]
+	}
+	if strings.HasPrefix(failure, "connection(") {
+		return "NetworkError"
+	}
+	return "Other"
+}
@@ -0,0 +1,202 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"time"
+)
+
+//Buckets are laid out like an HDR histogram: values below subBucketCount are exact,
+//above it every power of two is split in subBucketHalf linear sub buckets (< 1.6% error)
+const (
+	subBucketMagnitude = 7
+	subBucketCount     = 1 << subBucketMagnitude
+	subBucketHalf      = subBucketCount / 2
+)
+
+//Histogram records durations with microsecond resolution, it is not safe for concurrent use
+type Histogram struct {
+	counts []int64
+	total  int64
+	sum    int64
+	min    int64
+	max    int64
+}
+
+//LatencySummary of a histogram, all values in milliseconds
+type LatencySummary struct {
+	Count  int64   `json:"count"`
+	MinMs  float64 `json:"min_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	P999Ms float64 `json:"p999_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+//NewHistogram creates an empty histogram
+func NewHistogram() *Histogram {
+	return &Histogram{}
+}
+
+//Record adds a duration to the histogram
+func (h *Histogram) Record(duration time.Duration) {
+	h.RecordValue(int64(duration / time.Microsecond))
+}
+
+//RecordMs adds a value in milliseconds to the histogram
+func (h *Histogram) RecordMs(value float64) {
+	h.RecordValue(int64(value * 1000))
+}
+
+//RecordValue adds a value in microseconds to the histogram
+func (h *Histogram) RecordValue(value int64) {
+	if value < 0 {
+		value = 0
+	}
+	index := bucketIndex(value)
+	if index >= len(h.counts) {
+		h.counts = append(h.counts, make([]int64, index-len(h.counts)+1)...)
+	}
+	h.counts[index]++
+
+	if h.total == 0 || value < h.min {
+		h.min = value
+	}
+	if value > h.max {
+		h.max = value
+	}
+	h.total++
+	h.sum += value
+}
+
+//Merge adds every value recorded by other to the histogram
+func (h *Histogram) Merge(other *Histogram) {
+	if other.total == 0 {
+		return
+	}
+	if len(other.counts) > len(h.counts) {
+		h.counts = append(h.counts, make([]int64, len(other.counts)-len(h.counts))...)
+	}
+	for index, count := range other.counts {
+		h.counts[index] += count
+	}
+	if h.total == 0 || other.min < h.min {
+		h.min = other.min
+	}
+	if other.max > h.max {
+		h.max = other.max
+	}
+	h.total += other.total
+	h.sum += other.sum
+}
+
+//Copy returns an independent copy of the histogram
+func (h *Histogram) Copy() *Histogram {
+	histogram := NewHistogram()
+	histogram.Merge(h)
+	return histogram
+}
+
+//Count returns the number of recorded values
+func (h *Histogram) Count() int64 {
+	return h.total
+}
+
+//Sum returns the sum of the recorded values, in microseconds
+func (h *Histogram) Sum() int64 {
+	return h.sum
+}
+
+//Max returns the highest recorded value, in microseconds
+func (h *Histogram) Max() int64 {
+	return h.max
+}
+
+//ValueAtPercentile returns the value, in microseconds, below which the given percentage of the values fall
+func (h *Histogram) ValueAtPercentile(percentile float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	if percentile > 100 {
+		percentile = 100
+	}
+	target := int64(math.Ceil(percentile / 100 * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+
+	var accumulated int64
+	for index, count := range h.counts {
+		accumulated += count
+		if accumulated >= target {
+			value := highestEquivalentValue(index)
+			if value > h.max {
+				value = h.max
+			}
+			if value < h.min {
+				value = h.min
+			}
+			return value
+		}
+	}
+	return h.max
+}
+
+//CountAtOrBelow returns how many recorded values are lower or equal than value, in microseconds
+func (h *Histogram) CountAtOrBelow(value int64) int64 {
+	var accumulated int64
+	for index, count := range h.counts {
+		if highestEquivalentValue(index) > value {
+			break
+		}
+		accumulated += count
+	}
+	return accumulated
+}
+
+//Summary returns the usual percentiles of the histogram
+func (h *Histogram) Summary() LatencySummary {
+	if h.total == 0 {
+		return LatencySummary{}
+	}
+	return LatencySummary{
+		Count:  h.total,
+		MinMs:  toMs(h.min),
+		MeanMs: float64(h.sum) / float64(h.total) / 1000,
+		P50Ms:  toMs(h.ValueAtPercentile(50)),
+		P90Ms:  toMs(h.ValueAtPercentile(90)),
+		P99Ms:  toMs(h.ValueAtPercentile(99)),
+		P999Ms: toMs(h.ValueAtPercentile(99.9)),
+		MaxMs:  toMs(h.max),
+	}
+}
+
+func (l LatencySummary) String() string {
+	return fmt.Sprintf("{count=%d, p50=%.2fms, p90=%.2fms, p99=%.2fms, p99.9=%.2fms, max=%.2fms}",
+		l.Count, l.P50Ms, l.P90Ms, l.P99Ms, l.P999Ms, l.MaxMs)
+}
+
+func toMs(value int64) float64 {
+	return float64(value) / 1000
+}
+
+func bucketIndex(value int64) int {
+	if value < subBucketCount {
+		return int(value)
+	}
+	shift := bits.Len64(uint64(value)) - subBucketMagnitude
+	subBucket := int(value >> uint(shift))
+	return subBucketCount + (shift-1)*subBucketHalf + (subBucket - subBucketHalf)
+}
+
+func highestEquivalentValue(index int) int64 {
+	if index < subBucketCount {
+		return int64(index)
+	}
+	shift := (index-subBucketCount)/subBucketHalf + 1
+	subBucket := int64((index-subBucketCount)%subBucketHalf + subBucketHalf)
+	return ((subBucket + 1) << uint(shift)) - 1
+}
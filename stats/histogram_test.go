@@ -0,0 +1,109 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBucketsAreExactBelowTheSubBuckets(t *testing.T) {
+	for value := int64(0); value < subBucketCount; value++ {
+		if got := highestEquivalentValue(bucketIndex(value)); got != value {
+			t.Fatalf("%d: got %d", value, got)
+		}
+	}
+}
+
+func TestBucketBounds(t *testing.T) {
+	previous := -1
+	for value := int64(0); value < 1<<22; value += 1 + value/97 {
+		index := bucketIndex(value)
+		if index < previous {
+			t.Fatalf("%d: index %d goes back from %d", value, index, previous)
+		}
+		previous = index
+
+		highest := highestEquivalentValue(index)
+		if highest < value {
+			t.Fatalf("%d: bucket %d ends at %d, before the value", value, index, highest)
+		}
+		if relative := float64(highest-value) / float64(value+1); relative > 1.0/subBucketHalf {
+			t.Fatalf("%d: bucket %d ends at %d, %.2f%% away", value, index, highest, 100*relative)
+		}
+		if index > 0 && highestEquivalentValue(index-1) >= value {
+			t.Fatalf("%d: also fits the previous bucket %d", value, index-1)
+		}
+	}
+}
+
+func TestValueAtPercentile(t *testing.T) {
+	histogram := NewHistogram()
+	for value := int64(1); value <= 10000; value++ {
+		histogram.RecordValue(value)
+	}
+
+	for _, percentile := range []float64{1, 50, 90, 99, 99.9} {
+		want := percentile * 100
+		got := float64(histogram.ValueAtPercentile(percentile))
+		if math.Abs(got-want)/want > 1.0/subBucketHalf {
+			t.Errorf("p%v: got %v, want %v", percentile, got, want)
+		}
+	}
+	if got := histogram.ValueAtPercentile(100); got != 10000 {
+		t.Errorf("p100: got %d, want the max", got)
+	}
+	if got := histogram.ValueAtPercentile(0); got != 1 {
+		t.Errorf("p0: got %d, want the min", got)
+	}
+}
+
+func TestPercentileIsClampedToTheRecordedValues(t *testing.T) {
+	histogram := NewHistogram()
+	histogram.RecordValue(1000)
+
+	for _, percentile := range []float64{0, 50, 100, 150} {
+		if got := histogram.ValueAtPercentile(percentile); got != 1000 {
+			t.Errorf("p%v: got %d, want 1000", percentile, got)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	histogram := NewHistogram()
+	if summary := histogram.Summary(); summary != (LatencySummary{}) {
+		t.Errorf("empty: got %+v", summary)
+	}
+
+	histogram.Record(2 * time.Millisecond)
+	histogram.RecordMs(4)
+	histogram.RecordValue(-5)
+	summary := histogram.Summary()
+	if summary.Count != 3 || summary.MinMs != 0 || summary.MaxMs != 4 || summary.MeanMs != 2 {
+		t.Errorf("got %+v, want 3 values from 0 to 4ms with a mean of 2ms", summary)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	low := NewHistogram()
+	high := NewHistogram()
+	for value := int64(1); value <= 100; value++ {
+		low.RecordValue(value)
+		high.RecordValue(value * 1000)
+	}
+
+	merged := low.Copy()
+	merged.Merge(high)
+	merged.Merge(NewHistogram())
+	if merged.Count() != 200 || merged.Max() != 100000 || merged.Sum() != low.Sum()+high.Sum() {
+		t.Errorf("got %d values up to %d summing %d", merged.Count(), merged.Max(), merged.Sum())
+	}
+	if got := merged.ValueAtPercentile(50); got != 100 {
+		t.Errorf("p50: got %d, want 100", got)
+	}
+	if low.Count() != 100 {
+		t.Errorf("the copy changed the original: %d values", low.Count())
+	}
+	if got := merged.CountAtOrBelow(100); got != 100 {
+		t.Errorf("count at or below 100: got %d, want 100", got)
+	}
+}
@@ -2,62 +2,268 @@ package stats
 
 import (
 	"fmt"
+	"sort"
 	"sync"
-	"sync/atomic"
+	"time"
 
 	"go.mongodb.org/mongo-driver/event"
 )
 
+//maxPoolEvents caps the pool lifecycle events kept, they are still counted
+const maxPoolEvents = 500
+
+//Pool lifecycle event types
+const (
+	PoolCreated = "pool_created"
+	PoolReady   = "pool_ready"
+	PoolCleared = "pool_cleared"
+	PoolClosed  = "pool_closed"
+)
+
+//PoolStats collects the connection pool events, for every pool and by server address since each member
+//of a replica set has its own pool
 type PoolStats struct {
-	Created    int64
-	Closed     int64
-	InUse      int64
-	Returned   int64
-	GetsOK     int64
-	GetsFailed int64
-	Reasons    map[string]int64
-	mutex      sync.RWMutex
+	total   *poolCounters
+	servers map[string]*poolCounters
+	//openedAt is when every open connection was created, to measure its lifetime
+	openedAt   map[connectionKey]time.Time
+	events     []PoolLifecycleEvent
+	eventCount int64
+	mutex      sync.Mutex
 }
 
+type connectionKey struct {
+	address string
+	id      uint64
+}
+
+type poolCounters struct {
+	created      int64
+	ready        int64
+	closed       int64
+	inUse        int64
+	peakInUse    int64
+	returned     int64
+	getsStarted  int64
+	getsOK       int64
+	getsFailed   int64
+	clears       int64
+	reasons      map[string]int64
+	checkoutWait *Histogram
+	establish    *Histogram
+	lifetime     *Histogram
+}
+
+//PoolLifecycleEvent is a pool of a server being created, cleared or closed
+type PoolLifecycleEvent struct {
+	Time         time.Time `json:"time"`
+	Type         string    `json:"type"`
+	Address      string    `json:"address"`
+	ServiceID    string    `json:"service_id,omitempty"`
+	Interruption bool      `json:"interrupt_in_use,omitempty"`
+	MaxPoolSize  uint64    `json:"max_pool_size,omitempty"`
+	MinPoolSize  uint64    `json:"min_pool_size,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+//NewPoolStats creates an empty collector
 func NewPoolStats() *PoolStats {
 	return &PoolStats{
-		Reasons: make(map[string]int64),
+		total:    newPoolCounters(),
+		servers:  make(map[string]*poolCounters),
+		openedAt: make(map[connectionKey]time.Time),
+	}
+}
+
+func newPoolCounters() *poolCounters {
+	return &poolCounters{
+		reasons:      make(map[string]int64),
+		checkoutWait: NewHistogram(),
+		establish:    NewHistogram(),
+		lifetime:     NewHistogram(),
 	}
 }
 
 func (p *PoolStats) MonitorFunc(poolEvent *event.PoolEvent) {
+	now := time.Now()
+	key := connectionKey{poolEvent.Address, poolEvent.ConnectionID}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, counters := range []*poolCounters{p.total, p.server(poolEvent.Address)} {
+		switch poolEvent.Type {
+		case event.ConnectionCreated:
+			counters.created++
+		case event.ConnectionReady:
+			counters.ready++
+			counters.establish.Record(poolEvent.Duration)
+		case event.ConnectionClosed:
+			counters.closed++
+			if openedAt, ok := p.openedAt[key]; ok {
+				counters.lifetime.Record(now.Sub(openedAt))
+			}
+		case event.ConnectionReturned:
+			counters.returned++
+			counters.inUse--
+		case event.GetStarted:
+			counters.getsStarted++
+		case event.GetSucceeded:
+			counters.getsOK++
+			counters.inUse++
+			if counters.inUse > counters.peakInUse {
+				counters.peakInUse = counters.inUse
+			}
+			counters.checkoutWait.Record(poolEvent.Duration)
+		case event.GetFailed:
+			counters.getsFailed++
+			counters.reasons[poolEvent.Reason]++
+			counters.checkoutWait.Record(poolEvent.Duration)
+		case event.PoolCleared:
+			counters.clears++
+		}
+	}
+
 	switch poolEvent.Type {
 	case event.ConnectionCreated:
-		atomic.AddInt64(&p.Created, 1)
+		p.openedAt[key] = now
 	case event.ConnectionClosed:
-		atomic.AddInt64(&p.Closed, 1)
-	case event.ConnectionReturned:
-		atomic.AddInt64(&p.Returned, 1)
-		atomic.AddInt64(&p.InUse, -1)
-	case event.GetSucceeded:
-		atomic.AddInt64(&p.GetsOK, 1)
-		atomic.AddInt64(&p.InUse, 1)
-	case event.GetFailed:
-		atomic.AddInt64(&p.GetsFailed, 1)
-		_, ok := p.Reasons[poolEvent.Reason]
-		p.mutex.Lock()
-		if ok {
-			p.Reasons[poolEvent.Reason] = p.Reasons[poolEvent.Reason] + 1
-		} else {
-			p.Reasons[poolEvent.Reason] = 1
+		delete(p.openedAt, key)
+	case event.PoolCreated, event.PoolReady, event.PoolCleared, event.PoolClosedEvent:
+		p.addEvent(now, poolEvent)
+	}
+}
+
+//server returns the counters of a server address, p.mutex must be held
+func (p *PoolStats) server(address string) *poolCounters {
+	counters, ok := p.servers[address]
+	if !ok {
+		counters = newPoolCounters()
+		p.servers[address] = counters
+	}
+	return counters
+}
+
+//addEvent keeps a pool lifecycle event, p.mutex must be held
+func (p *PoolStats) addEvent(now time.Time, poolEvent *event.PoolEvent) {
+	lifecycleEvent := PoolLifecycleEvent{
+		Time:         now,
+		Address:      poolEvent.Address,
+		Interruption: poolEvent.Interruption,
+	}
+	switch poolEvent.Type {
+	case event.PoolCreated:
+		lifecycleEvent.Type = PoolCreated
+		if options := poolEvent.PoolOptions; options != nil {
+			lifecycleEvent.MaxPoolSize = options.MaxPoolSize
+			lifecycleEvent.MinPoolSize = options.MinPoolSize
 		}
-		p.mutex.Unlock()
+	case event.PoolReady:
+		lifecycleEvent.Type = PoolReady
+	case event.PoolCleared:
+		lifecycleEvent.Type = PoolCleared
+	case event.PoolClosedEvent:
+		lifecycleEvent.Type = PoolClosed
+	}
+	if poolEvent.ServiceID != nil {
+		lifecycleEvent.ServiceID = poolEvent.ServiceID.Hex()
+	}
+	if poolEvent.Error != nil {
+		lifecycleEvent.Error = poolEvent.Error.Error()
+	}
+
+	p.eventCount++
+	if len(p.events) < maxPoolEvents {
+		p.events = append(p.events, lifecycleEvent)
+	}
+}
+
+//PoolSnapshot is a point in time copy of the pool counters, the durations are in milliseconds
+type PoolSnapshot struct {
+	Created      int64                   `json:"created"`
+	Ready        int64                   `json:"ready"`
+	Closed       int64                   `json:"closed"`
+	InUse        int64                   `json:"in_use"`
+	PeakInUse    int64                   `json:"peak_in_use"`
+	Returned     int64                   `json:"returned"`
+	GetsStarted  int64                   `json:"gets_started"`
+	GetsOK       int64                   `json:"gets_ok"`
+	GetsFailed   int64                   `json:"gets_failed"`
+	Reasons      map[string]int64        `json:"failures"`
+	CheckoutWait LatencySummary          `json:"checkout_wait"`
+	Establish    LatencySummary          `json:"establish"`
+	Lifetime     LatencySummary          `json:"lifetime"`
+	Clears       int64                   `json:"clears"`
+	EventCount   int64                   `json:"event_count,omitempty"`
+	Events       []PoolLifecycleEvent    `json:"events,omitempty"`
+	Servers      map[string]PoolSnapshot `json:"servers,omitempty"`
+}
+
+//Snapshot returns a copy of the current counters, safe to be serialized
+func (p *PoolStats) Snapshot() PoolSnapshot {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	snapshot := p.total.snapshot()
+	snapshot.EventCount = p.eventCount
+	snapshot.Events = append([]PoolLifecycleEvent{}, p.events...)
+	snapshot.Servers = make(map[string]PoolSnapshot, len(p.servers))
+	for address, counters := range p.servers {
+		snapshot.Servers[address] = counters.snapshot()
+	}
+	return snapshot
+}
+
+func (c *poolCounters) snapshot() PoolSnapshot {
+	reasons := make(map[string]int64, len(c.reasons))
+	for reason, count := range c.reasons {
+		reasons[reason] = count
+	}
+	return PoolSnapshot{
+		Created:      c.created,
+		Ready:        c.ready,
+		Closed:       c.closed,
+		InUse:        c.inUse,
+		PeakInUse:    c.peakInUse,
+		Returned:     c.returned,
+		GetsStarted:  c.getsStarted,
+		GetsOK:       c.getsOK,
+		GetsFailed:   c.getsFailed,
+		Reasons:      reasons,
+		CheckoutWait: c.checkoutWait.Summary(),
+		Establish:    c.establish.Summary(),
+		Lifetime:     c.lifetime.Summary(),
+		Clears:       c.clears,
 	}
 }
 
+//Addresses returns the server addresses of the snapshot, sorted
+func (p PoolSnapshot) Addresses() []string {
+	addresses := make([]string, 0, len(p.Servers))
+	for address := range p.Servers {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 func (p *PoolStats) String() string {
+	return p.Snapshot().String()
+}
+
+func (p PoolSnapshot) String() string {
 	return fmt.Sprintf("{"+
 		"created=%d, "+
 		"closed=%d, "+
 		"in_use=%d, "+
+		"peak_in_use=%d, "+
 		"returned=%d, "+
 		"gets_OK=%d, "+
 		"gets_failed=%d, "+
-		"failures=%v"+
-		"}", p.Created, p.Closed, p.InUse, p.Returned, p.GetsOK, p.GetsFailed, p.Reasons)
+		"failures=%v, "+
+		"clears=%d, "+
+		"checkout_wait=%v, "+
+		"lifetime=%v"+
+		"}", p.Created, p.Closed, p.InUse, p.PeakInUse, p.Returned, p.GetsOK, p.GetsFailed, p.Reasons, p.Clears,
+		p.CheckoutWait, p.Lifetime)
 }
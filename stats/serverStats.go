@@ -0,0 +1,252 @@
+package stats
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/description"
+)
+
+//maxServerEvents caps the topology events kept, heartbeats are only counted
+const maxServerEvents = 500
+
+//Server event types
+const (
+	TopologyChanged = "topology_changed"
+	ServerChanged   = "server_changed"
+	ServerOpened    = "server_opened"
+	ServerClosed    = "server_closed"
+	HeartbeatFailed = "heartbeat_failed"
+)
+
+//ServerStats collects the server discovery and monitoring events
+type ServerStats struct {
+	events        []ServerEvent
+	eventCount    int64
+	heartbeats    map[string]*heartbeatCounters
+	lastPrimaryOp time.Time
+	mutex         sync.Mutex
+}
+
+//ServerEvent is a change in the topology seen by the driver
+type ServerEvent struct {
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Address  string    `json:"address,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Current  string    `json:"current,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type heartbeatCounters struct {
+	succeeded int64
+	failed    int64
+	kind      string
+	latency   *Histogram
+	maxLag    time.Duration
+	lastError string
+}
+
+//HeartbeatSummary of a single server
+type HeartbeatSummary struct {
+	Succeeded  int64          `json:"succeeded"`
+	Failed     int64          `json:"failed"`
+	Kind       string         `json:"kind"`
+	Latency    LatencySummary `json:"latency"`
+	MaxLagSecs float64        `json:"max_lag_secs"`
+	LastError  string         `json:"last_error,omitempty"`
+}
+
+//ServerSnapshot is a point in time copy of the server monitoring counters
+type ServerSnapshot struct {
+	EventCount int64                       `json:"event_count"`
+	Events     []ServerEvent               `json:"events"`
+	Heartbeats map[string]HeartbeatSummary `json:"heartbeats"`
+}
+
+//NewServerStats creates an empty collector
+func NewServerStats() *ServerStats {
+	return &ServerStats{
+		heartbeats: make(map[string]*heartbeatCounters),
+	}
+}
+
+//Monitor returns the driver monitor feeding this collector
+func (s *ServerStats) Monitor() *event.ServerMonitor {
+	return &event.ServerMonitor{
+		TopologyDescriptionChanged: s.topologyChanged,
+		ServerDescriptionChanged:   s.serverChanged,
+		ServerOpening:              s.serverOpening,
+		ServerClosed:               s.serverClosed,
+		ServerHeartbeatSucceeded:   s.heartbeatSucceeded,
+		ServerHeartbeatFailed:      s.heartbeatFailed,
+	}
+}
+
+func (s *ServerStats) topologyChanged(changedEvent *event.TopologyDescriptionChangedEvent) {
+	s.add(ServerEvent{
+		Type:     TopologyChanged,
+		Previous: topologyString(changedEvent.PreviousDescription),
+		Current:  topologyString(changedEvent.NewDescription),
+	})
+}
+
+func (s *ServerStats) serverChanged(changedEvent *event.ServerDescriptionChangedEvent) {
+	serverEvent := ServerEvent{
+		Type:     ServerChanged,
+		Address:  changedEvent.Address.String(),
+		Previous: changedEvent.PreviousDescription.Kind.String(),
+		Current:  changedEvent.NewDescription.Kind.String(),
+	}
+	if changedEvent.NewDescription.LastError != nil {
+		serverEvent.Error = changedEvent.NewDescription.LastError.Error()
+	}
+	s.add(serverEvent)
+}
+
+func (s *ServerStats) serverOpening(openingEvent *event.ServerOpeningEvent) {
+	s.add(ServerEvent{Type: ServerOpened, Address: openingEvent.Address.String()})
+}
+
+func (s *ServerStats) serverClosed(closedEvent *event.ServerClosedEvent) {
+	s.add(ServerEvent{Type: ServerClosed, Address: closedEvent.Address.String()})
+}
+
+func (s *ServerStats) heartbeatSucceeded(succeededEvent *event.ServerHeartbeatSucceededEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	counters := s.counters(serverAddress(succeededEvent.ConnectionID))
+	counters.succeeded++
+	counters.kind = succeededEvent.Reply.Kind.String()
+	counters.latency.Record(time.Duration(succeededEvent.DurationNanos))
+
+	//the lag of a secondary is measured against the last write seen on the primary
+	lastWrite := succeededEvent.Reply.LastWriteTime
+	switch succeededEvent.Reply.Kind {
+	case description.RSPrimary:
+		if lastWrite.After(s.lastPrimaryOp) {
+			s.lastPrimaryOp = lastWrite
+		}
+	case description.RSSecondary:
+		if !lastWrite.IsZero() && !s.lastPrimaryOp.IsZero() {
+			if lag := s.lastPrimaryOp.Sub(lastWrite); lag > counters.maxLag {
+				counters.maxLag = lag
+			}
+		}
+	}
+}
+
+func (s *ServerStats) heartbeatFailed(failedEvent *event.ServerHeartbeatFailedEvent) {
+	address := serverAddress(failedEvent.ConnectionID)
+	serverEvent := ServerEvent{Type: HeartbeatFailed, Address: address}
+
+	s.mutex.Lock()
+	counters := s.counters(address)
+	counters.failed++
+	counters.latency.Record(time.Duration(failedEvent.DurationNanos))
+	if failedEvent.Failure != nil {
+		counters.lastError = failedEvent.Failure.Error()
+		serverEvent.Error = counters.lastError
+	}
+	s.mutex.Unlock()
+
+	s.add(serverEvent)
+}
+
+func (s *ServerStats) add(serverEvent ServerEvent) {
+	serverEvent.Time = time.Now()
+
+	s.mutex.Lock()
+	s.eventCount++
+	if len(s.events) < maxServerEvents {
+		s.events = append(s.events, serverEvent)
+	}
+	s.mutex.Unlock()
+}
+
+func (s *ServerStats) counters(address string) *heartbeatCounters {
+	counters, ok := s.heartbeats[address]
+	if !ok {
+		counters = &heartbeatCounters{latency: NewHistogram()}
+		s.heartbeats[address] = counters
+	}
+	return counters
+}
+
+//EventsSince returns how many topology events happened after the given time
+func (s *ServerStats) EventsSince(since time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	count := 0
+	for _, serverEvent := range s.events {
+		if !serverEvent.Time.Before(since) {
+			count++
+		}
+	}
+	return count
+}
+
+//Snapshot returns a copy of the current counters, safe to be serialized
+func (s *ServerStats) Snapshot() ServerSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot := ServerSnapshot{
+		EventCount: s.eventCount,
+		Events:     append([]ServerEvent{}, s.events...),
+		Heartbeats: make(map[string]HeartbeatSummary, len(s.heartbeats)),
+	}
+	for address, counters := range s.heartbeats {
+		snapshot.Heartbeats[address] = HeartbeatSummary{
+			Succeeded:  counters.succeeded,
+			Failed:     counters.failed,
+			Kind:       counters.kind,
+			Latency:    counters.latency.Summary(),
+			MaxLagSecs: counters.maxLag.Seconds(),
+			LastError:  counters.lastError,
+		}
+	}
+	return snapshot
+}
+
+//Addresses returns the monitored servers, sorted
+func (s ServerSnapshot) Addresses() []string {
+	addresses := make([]string, 0, len(s.Heartbeats))
+	for address := range s.Heartbeats {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func (s ServerSnapshot) String() string {
+	var parts []string
+	for _, address := range s.Addresses() {
+		heartbeat := s.Heartbeats[address]
+		parts = append(parts, fmt.Sprintf("%s={kind=%s, heartbeats_OK=%d, heartbeats_failed=%d, p99=%.2fms, max_lag=%.1fs}",
+			address, heartbeat.Kind, heartbeat.Succeeded, heartbeat.Failed, heartbeat.Latency.P99Ms, heartbeat.MaxLagSecs))
+	}
+	return fmt.Sprintf("{events=%d, %s}", s.EventCount, strings.Join(parts, ", "))
+}
+
+func topologyString(topology description.Topology) string {
+	var servers []string
+	for _, server := range topology.Servers {
+		servers = append(servers, server.Addr.String()+"="+server.Kind.String())
+	}
+	return fmt.Sprintf("%s[%s]", topology.Kind.String(), strings.Join(servers, ", "))
+}
+
+//serverAddress removes the connection number from a heartbeat connection id, "localhost:27017[-3]"
+func serverAddress(connectionID string) string {
+	if index := strings.LastIndex(connectionID, "["); index > 0 {
+		return connectionID[:index]
+	}
+	return connectionID
+}